@@ -1,18 +1,200 @@
 package main
 
 import (
+  "encoding/json"
+  "flag"
   "fmt"
   "os"
+  "strings"
+  "time"
   "./ansible/executor"
+  "./ansible/inventory"
+  "./ansible/playbook"
+  "./ansible/plugins"
+  "./ansible/vars"
 )
 
-func main() {
-  if len(os.Args) < 2 {
-    fmt.Println("You must specify one or more playbooks to run")
+// a flag which may be given multiple times on the command line
+type listFlag []string
+
+func (l *listFlag) String() string {
+  return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+  *l = append(*l, value)
+  return nil
+}
+
+// the options shared by every command which loads the inventory
+type inventoryOptions struct {
+  sources listFlag
+  limit string
+  cache bool
+  cache_timeout int
+  flush_cache bool
+}
+
+func addInventoryFlags(fs *flag.FlagSet) *inventoryOptions {
+  opts := new(inventoryOptions)
+  fs.Var(&opts.sources, "i", "specify inventory host path (may be given more than once)")
+  fs.Var(&opts.sources, "inventory", "specify inventory host path (may be given more than once)")
+  fs.StringVar(&opts.limit, "l", "", "further limit selected hosts to an additional pattern")
+  fs.StringVar(&opts.limit, "limit", "", "further limit selected hosts to an additional pattern")
+  fs.BoolVar(&opts.cache, "inventory-cache", inventory.InventoryCacheEnabled(), "keep the parsed inventory in a cache, which is off unless set here or with ANSIBLE_INVENTORY_CACHE")
+  fs.IntVar(&opts.cache_timeout, "inventory-cache-timeout", -1, "seconds the inventory cache is used for, 0 to never expire, -1 to use ANSIBLE_INVENTORY_CACHE_TIMEOUT or 3600")
+  fs.BoolVar(&opts.flush_cache, "flush-cache", false, "clear the inventory cache and parse the inventory sources again (the cache is opt-in, see --inventory-cache)")
+  return opts
+}
+
+func loadInventory(opts *inventoryOptions) *inventory.InventoryManager {
+  sources := opts.sources
+  if len(sources) == 0 {
+    sources = listFlag{"/etc/ansible/hosts"}
+  }
+  var cache *inventory.InventoryCache
+  if opts.cache {
+    c, err := inventory.DefaultInventoryCache()
+    if err != nil {
+      fmt.Println("ERROR!", err)
+      os.Exit(1)
+    }
+    if opts.cache_timeout >= 0 {
+      c.Timeout = time.Duration(opts.cache_timeout) * time.Second
+    }
+    c.Flush = opts.flush_cache
+    cache = c
+  } else if opts.flush_cache {
+    fmt.Println("[WARNING]: --flush-cache has no effect, the inventory cache is not enabled (see --inventory-cache)")
+  }
+  inv, err := inventory.NewInventoryManager(sources, cache)
+  if err != nil {
+    fmt.Println("ERROR! Failed to parse inventory:", err)
+    os.Exit(1)
+  }
+  if err := inv.Subset(opts.limit); err != nil {
+    fmt.Println("ERROR!", err)
     os.Exit(1)
   }
+  return inv
+}
 
-  pbe := executor.NewPlaybookExecutor(os.Args[1:])
-  result := pbe.Run()
-  os.Exit(result)
+// parseArgs parses the flags, which may come before or after the
+// positional arguments (the flag package stops at the first of them),
+// and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+  fs.Parse(args)
+  positional := make([]string, 0)
+  for fs.NArg() > 0 {
+    positional = append(positional, fs.Arg(0))
+    fs.Parse(fs.Args()[1:])
+  }
+  return positional
+}
+
+func printJSON(data interface{}) int {
+  out, err := json.MarshalIndent(data, "", "    ")
+  if err != nil {
+    fmt.Println("ERROR!", err)
+    return 1
+  }
+  fmt.Println(string(out))
+  return 0
+}
+
+// runInventory implements "ansible inventory", which shows the
+// inventory as it was loaded from the given sources
+func runInventory(args []string) int {
+  fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+  opts := addInventoryFlags(fs)
+  var list, graph, export bool
+  var host string
+  fs.BoolVar(&list, "list", false, "output all hosts info, works as an inventory script")
+  fs.BoolVar(&graph, "graph", false, "create inventory graph, takes an optional group name (default: all)")
+  fs.StringVar(&host, "host", "", "output specific host info, works as an inventory script")
+  fs.BoolVar(&export, "export", false, "with --list, keep group vars with their groups instead of merging them into the hostvars")
+  positional := parseArgs(fs, args)
+
+  modes := 0
+  for _, set := range []bool{list, graph, host != ""} {
+    if set {
+      modes += 1
+    }
+  }
+  if modes == 0 {
+    fmt.Println("ERROR! No action selected, at least one of --host, --graph or --list needs to be specified")
+    return 1
+  } else if modes > 1 {
+    fmt.Println("ERROR! Conflicting options used, only one of --host, --graph or --list can be used at the same time")
+    return 1
+  }
+
+  inv := loadInventory(opts)
+  switch {
+  case list:
+    return printJSON(inv.ListJSON(export))
+  case graph:
+    group := "all"
+    if len(positional) > 0 {
+      group = positional[0]
+    }
+    lines, err := inv.Graph(group)
+    if err != nil {
+      fmt.Println("ERROR!", err)
+      return 1
+    }
+    fmt.Println(strings.Join(lines, "\n"))
+  default:
+    h := inv.GetHost(host)
+    if h == nil {
+      fmt.Println("ERROR! Could not match supplied host pattern:", host)
+      return 1
+    }
+    vars := h.GetGroupVars()
+    for k, v := range h.GetHostVars() {
+      vars[k] = v
+    }
+    return printJSON(vars)
+  }
+  return 0
+}
+
+// runPlaybook implements the default command, which runs playbooks
+func runPlaybook(args []string) int {
+  fs := flag.NewFlagSet("ansible", flag.ExitOnError)
+  opts := addInventoryFlags(fs)
+  var extra_vars listFlag
+  fs.Var(&extra_vars, "e", "set additional variables as key=value, YAML/JSON or @file (may be given more than once)")
+  fs.Var(&extra_vars, "extra-vars", "set additional variables as key=value, YAML/JSON or @file (may be given more than once)")
+  playbooks := parseArgs(fs, args)
+
+  if len(playbooks) < 1 {
+    fmt.Println("You must specify one or more playbooks to run")
+    return 1
+  }
+
+  loaded_extra_vars, err := vars.LoadExtraVars(extra_vars)
+  if err != nil {
+    fmt.Println("ERROR!", err)
+    return 1
+  }
+
+  inv := loadInventory(opts)
+  variable_manager := vars.NewVariableManager(inv)
+  variable_manager.ExtraVars = loaded_extra_vars
+  pbe := executor.NewPlaybookExecutor(playbooks, inv, variable_manager)
+  return pbe.Run()
+}
+
+func main() {
+  inventory.LoadExternalInventoryPlugin = plugins.LoadInventoryPlugin
+  inventory.TemplateExpression = playbook.TemplateExpression
+  inventory.EvaluateExpression = playbook.EvaluateExpression
+  plugins.LoadFilterPlugins()
+  plugins.LoadTestPlugins()
+  plugins.LoadLookupPlugins()
+  if len(os.Args) > 1 && os.Args[1] == "inventory" {
+    os.Exit(runInventory(os.Args[2:]))
+  }
+  os.Exit(runPlaybook(os.Args[1:]))
 }
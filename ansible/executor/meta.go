@@ -0,0 +1,102 @@
+package executor
+
+import (
+  "fmt"
+  "../inventory"
+  "../playbook"
+)
+
+// the meta tasks which act on the play as a whole, and
+// so only run once even when every host reaches them
+var run_once_meta_actions = []string{"end_play", "end_batch", "refresh_inventory", "clear_host_errors"}
+
+// runMetaTasks runs the meta tasks the hosts have reached, once the
+// tasks the other hosts were running at the same time have finished.
+// Each meta task only acts on the hosts for which its conditional is
+// true, and any handlers are flushed together at the end.
+func (tqm *TaskQueueManager) runMetaTasks(iterator *PlayIterator, play *playbook.Play, play_context *playbook.PlayContext, hosts []inventory.Host, tasks []*playbook.Task) {
+  ran_once := make(map[string]bool)
+  flush_hosts := make([]inventory.Host, 0)
+  for i, host := range hosts {
+    t := tasks[i]
+    meta_action, _ := t.Args()["_raw_params"].(string)
+    res := map[string]interface{}{"changed": false}
+    task_vars, err := tqm.VarManager.GetVars(play, &host, t)
+    if err != nil {
+      res["failed"] = true
+      res["msg"] = err.Error()
+      fmt.Println(TaskResult{host, *t, res})
+      continue
+    }
+    ok, false_condition, err := t.EvaluateConditional(playbook.NewTemplar(task_vars))
+    if err != nil {
+      res["failed"] = true
+      res["msg"] = err.Error()
+      fmt.Println(TaskResult{host, *t, res})
+      continue
+    }
+    if !ok {
+      res["skipped"] = true
+      res["skip_reason"] = "Conditional result was False: " + false_condition
+      res["false_condition"] = false_condition
+      fmt.Println(TaskResult{host, *t, res})
+      continue
+    }
+    if playbook.StringPos(meta_action, run_once_meta_actions) != -1 {
+      if ran_once[meta_action] {
+        continue
+      }
+      ran_once[meta_action] = true
+    }
+
+    switch meta_action {
+    case "noop":
+      // nothing to do
+    case "flush_handlers":
+      flush_hosts = append(flush_hosts, host)
+    case "end_host":
+      iterator.EndHost(host)
+      res["msg"] = "ending play for " + host.Name
+    case "end_batch", "end_play":
+      for _, batch_host := range tqm.Inventory.GetHosts(play.Hosts()) {
+        iterator.EndHost(batch_host)
+      }
+      if meta_action == "end_play" {
+        play.EndPlay = true
+        res["msg"] = "ending play"
+      } else {
+        res["msg"] = "ending batch"
+      }
+    case "clear_facts":
+      tqm.VarManager.ClearFacts(host.Name)
+      res["msg"] = "facts cleared"
+    case "clear_host_errors":
+      // the failed hosts never reach this task,
+      // so it clears the errors of every host
+      for _, play_host := range tqm.Inventory.GetHosts(play.Hosts()) {
+        delete(tqm.FailedHosts, play_host.Name)
+        delete(tqm.UnreachableHosts, play_host.Name)
+        iterator.ClearHostErrors(play_host)
+      }
+      res["msg"] = "cleared host errors"
+    case "refresh_inventory":
+      if err := tqm.Inventory.Refresh(); err != nil {
+        res["failed"] = true
+        res["msg"] = err.Error()
+      } else {
+        res["msg"] = "inventory successfully refreshed"
+      }
+    case "reset_connection":
+      te := NewTaskExecutor(host, *t, *play_context, task_vars)
+      te.GetConnection().Reset()
+      res["msg"] = "reset connection"
+    default:
+      res["failed"] = true
+      res["msg"] = fmt.Sprintf("invalid meta action requested: %s", meta_action)
+    }
+    fmt.Println(TaskResult{host, *t, res})
+  }
+  if len(flush_hosts) > 0 {
+    tqm.RunHandlers(play, play_context, flush_hosts)
+  }
+}
@@ -127,7 +127,7 @@ func NewPlayIterator(
   }
 
   //start_at_matched := false
-  batch := tqm.Inventory.GetHosts()
+  batch := tqm.Inventory.GetHosts(play.Hosts())
   iterator.BatchSize = len(batch)
   for _, host := range batch {
     iterator.HostStates[host.Name] = NewHostState(iterator.blocks)
@@ -449,6 +449,34 @@ func (it *PlayIterator) IsFailed(host inventory.Host) bool {
   return it.CheckFailedState(s)
 }
 
+// EndHost stops the iteration for the host, so it runs no more tasks
+func (it *PlayIterator) EndHost(host inventory.Host) {
+  s := it.GetHostState(host)
+  s.RunState = ITERATING_COMPLETE
+  it.HostStates[host.Name] = s
+}
+
+// ClearHostErrors forgets that the host failed, along
+// with any failures in the blocks it is running
+func (it *PlayIterator) ClearHostErrors(host inventory.Host) {
+  s := it.GetHostState(host)
+  for child := s; child != nil; {
+    child.FailState = ITERATING_FAILED_NONE
+    switch child.RunState {
+    case ITERATING_TASKS:
+      child = child.TasksChildState
+    case ITERATING_RESCUE:
+      child = child.RescueChildState
+    case ITERATING_ALWAYS:
+      child = child.AlwaysChildState
+    default:
+      child = nil
+    }
+  }
+  it.HostStates[host.Name] = s
+  delete(it.Play.RemovedHosts, host.Name)
+}
+
 func (it *PlayIterator) AddTasks(host inventory.Host, block_list []interface{}) {
   it.HostStates[host.Name] = it.InsertBlocksIntoState(it.GetHostState(host), block_list)
 }
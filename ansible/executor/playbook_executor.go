@@ -4,17 +4,21 @@ import (
   "fmt"
   "../inventory"
   "../playbook"
+  "../vars"
 )
 
 type PlaybookExecutor struct {
   Inventory *inventory.InventoryManager
+  VarManager *vars.VariableManager
   TQM *TaskQueueManager
   Playbooks []string
 }
 
-func (pbe *PlaybookExecutor) Load(playbooks []string) {
+func (pbe *PlaybookExecutor) Load(playbooks []string, inventory *inventory.InventoryManager, variable_manager *vars.VariableManager) {
   pbe.Playbooks = playbooks
-  pbe.TQM = NewTaskQueueManager(pbe.Inventory, false)
+  pbe.Inventory = inventory
+  pbe.VarManager = variable_manager
+  pbe.TQM = NewTaskQueueManager(pbe.Inventory, pbe.VarManager, false)
 }
 
 func (pbe *PlaybookExecutor) Run() int {
@@ -27,9 +31,18 @@ func (pbe *PlaybookExecutor) Run() int {
 
   for _, playbook_path := range pbe.Playbooks {
     pb := playbook.NewPlaybook(playbook_path)
+    // load the host_vars/ and group_vars/ next to this playbook
+    if err := pbe.Inventory.SetPlaybookDir(pb.BaseDir); err != nil {
+      fmt.Println("ERROR!", err)
+      result = 1
+      break
+    }
+    // vars_files are relative to the playbook
+    pbe.VarManager.BaseDir = pb.BaseDir
     for play_idx, play := range pb.Entries {
       // set loader basepath
       // clear inventory restriction
+      pbe.Inventory.RemoveRestriction()
       // post-validate the play
       validated_play, ok := playbook.PostValidate(&play).(*playbook.Play)
       if !ok {
@@ -55,10 +68,14 @@ func (pbe *PlaybookExecutor) Run() int {
         } else {
           for _, batch := range serial_batches {
             // set inventory restriction to batch
+            pbe.Inventory.RestrictToHosts(batch)
 
             // execute TQM Run()
             fmt.Println("running tqm")
             pbe.TQM.Run(validated_play)
+            if validated_play.EndPlay {
+              break
+            }
 
             // break the play if the result equals the special return code
 
@@ -93,11 +110,7 @@ func (pbe *PlaybookExecutor) Run() int {
 func (pbe *PlaybookExecutor) GetSerializedBatches(play playbook.Play) [][]inventory.Host {
   serialized_batches := make([][]inventory.Host, 0)
 
-  all_hosts := make([]inventory.Host, 0)
-  // FIXME: stub to create inventory
-  for _, h := range play.Hosts() {
-    all_hosts = append(all_hosts, *inventory.NewHost(h, nil))
-  }
+  all_hosts := pbe.Inventory.GetHosts(play.Hosts())
   all_hosts_len := len(all_hosts)
 
   serial_batch_list := play.Serial()
@@ -136,8 +149,8 @@ func (pbe *PlaybookExecutor) GetSerializedBatches(play playbook.Play) [][]invent
   return serialized_batches
 }
 
-func NewPlaybookExecutor(playbooks []string) *PlaybookExecutor {
+func NewPlaybookExecutor(playbooks []string, inventory *inventory.InventoryManager, variable_manager *vars.VariableManager) *PlaybookExecutor {
   pbe := new(PlaybookExecutor)
-  pbe.Load(playbooks)
+  pbe.Load(playbooks, inventory, variable_manager)
   return pbe
 }
@@ -1,6 +1,8 @@
 package executor
 
 import (
+  "fmt"
+  "time"
   "../inventory"
   "../playbook"
   "../plugins"
@@ -16,13 +18,33 @@ type TaskExecutor struct {
   Host inventory.Host
   Task playbook.Task
   PlayContext playbook.PlayContext
+  // the variables for this host and task, from the VariableManager
+  Vars map[string]interface{}
+  // sends callbacks from the worker, such as for each retry of the task
+  SendCallback func(string, ...CallbackArgs)
+  // the error from templating the loop, which is only raised once
+  // the conditional shows the task would actually run
+  loop_eval_error error
 }
 
 func (te *TaskExecutor) Run() TaskResult {
-  items := te.GetLoopItems()
   var res map[string]interface{} = nil
-  if items != nil {
-    // FIXME: all item stuff...
+  items, err := te.GetLoopItems()
+  if err != nil {
+    // a loop over an undefined variable is fine when the
+    // task is skipped, as with "when: foo is defined"
+    te.loop_eval_error = err
+    res = te.Execute(nil)
+  } else if items != nil {
+    if len(items) > 0 {
+      res = te.runLoop(items)
+    } else {
+      res = map[string]interface{} {
+        "skipped": true,
+        "skipped_reason": "No items in the list",
+        "results": []interface{}{},
+      }
+    }
   } else {
     res = te.Execute(nil)
   }
@@ -37,15 +59,124 @@ func (te *TaskExecutor) Run() TaskResult {
   return tr
 }
 
-func (te *TaskExecutor) GetLoopItems() []interface{} {
-  return nil
+// GetLoopItems returns the items the task loops over, or nil when the
+// task has no loop. A with_<lookup> loop uses the lookup to get the items.
+func (te *TaskExecutor) GetLoopItems() ([]interface{}, error) {
+  loop := te.Task.Loop()
+  if loop == nil {
+    return nil, nil
+  }
+  templar := playbook.NewTemplar(te.Vars)
+  templated, err := templar.Template(loop)
+  if err != nil {
+    return nil, err
+  }
+
+  if loop_with := te.Task.LoopWith(); loop_with != "" {
+    terms, ok := templated.([]interface{})
+    if !ok {
+      terms = []interface{}{templated}
+    }
+    items, err := templar.Query(loop_with, terms, nil)
+    if err != nil {
+      return nil, fmt.Errorf("Error in with_%s: %s", loop_with, err)
+    }
+    return items, nil
+  }
+
+  items, ok := templated.([]interface{})
+  if !ok {
+    return nil, fmt.Errorf("Invalid data passed to 'loop', it requires a list, got this instead: %v. Hint: If you passed a list/dict of just one element, try adding wantlist=True to your lookup invocation or use q/query instead of lookup.", templated)
+  }
+  return items, nil
+}
+
+// runs the task once for each item, returning a result
+// with the result of each item in its results
+func (te *TaskExecutor) runLoop(items []interface{}) map[string]interface{} {
+  loop_control := te.Task.LoopControl()
+  // each item templates its own copy of the task
+  task := te.Task
+
+  results := make([]interface{}, 0, len(items))
+  for i, item := range items {
+    if i > 0 && loop_control.Pause > 0 {
+      time.Sleep(time.Duration(loop_control.Pause * float64(time.Second)))
+    }
+
+    task_vars := make(map[string]interface{})
+    for k, v := range te.Vars {
+      task_vars[k] = v
+    }
+    task_vars[loop_control.LoopVar] = item
+    if loop_control.IndexVar != "" {
+      task_vars[loop_control.IndexVar] = i
+    }
+    if loop_control.Extended {
+      task_vars["ansible_loop"] = map[string]interface{} {
+        "allitems": items,
+        "index": i + 1,
+        "index0": i,
+        "first": i == 0,
+        "last": i == len(items) - 1,
+        "length": len(items),
+        "revindex": len(items) - i,
+        "revindex0": len(items) - i - 1,
+      }
+    }
+
+    te.Task = task
+    res := te.Execute(task_vars)
+    res[loop_control.LoopVar] = item
+    res["ansible_loop_var"] = loop_control.LoopVar
+    if loop_control.IndexVar != "" {
+      res[loop_control.IndexVar] = i
+      res["ansible_index_var"] = loop_control.IndexVar
+    }
+    if loop_control.Label != nil {
+      label, err := playbook.NewTemplar(task_vars).Template(loop_control.Label)
+      if err != nil {
+        label = loop_control.Label
+      }
+      res["_ansible_item_label"] = label
+    }
+    res["_ansible_item_result"] = true
+    results = append(results, res)
+  }
+  te.Task = task
+
+  res := map[string]interface{} {
+    "results": results,
+    "changed": false,
+    "msg": "All items completed",
+  }
+  skipped := true
+  for _, item := range results {
+    item_res := item.(map[string]interface{})
+    if changed, _ := item_res["changed"].(bool); changed {
+      res["changed"] = true
+    }
+    if failed, _ := item_res["failed"].(bool); failed {
+      res["failed"] = true
+      res["msg"] = "One or more items failed"
+    }
+    if item_skipped, _ := item_res["skipped"].(bool); !item_skipped {
+      skipped = false
+    }
+  }
+  if skipped {
+    res["skipped"] = true
+  }
+  if notify := te.Task.Notify(); notify != nil {
+    res["_ansible_notify"] = notify
+  }
+  return res
 }
 
 func (te *TaskExecutor) Execute(vars map[string]interface{}) map[string]interface{} {
   variables := vars
   if variables == nil {
-    // FIXME: use variables from struct, but this only matters for per-item stuff anyway
-    variables = make(map[string]interface{})
+    variables = te.Vars
   }
 
   // FIXME: play context updating and validation
@@ -69,25 +200,62 @@ func (te *TaskExecutor) Execute(vars map[string]interface{}) map[string]interfac
 
   // FIXME: update connection/shell plugin options
 
-  if !te.Task.EvaluateConditional() {
+  templar := playbook.NewTemplar(variables)
+  ok, false_condition, err := te.Task.EvaluateConditional(templar)
+  if err != nil {
+    return map[string]interface{} {
+      "changed": false,
+      "failed": true,
+      "msg": err.Error(),
+    }
+  }
+  if !ok {
     // FIXME: add no_log field in later
     return map[string]interface{} {
       "changed": false,
       "skipped": true,
-      "skip_reason": "Conditional result was False",
+      "skip_reason": "Conditional result was False: " + false_condition,
+      "false_condition": false_condition,
+    }
+  }
+  if te.loop_eval_error != nil {
+    return map[string]interface{} {
+      "changed": false,
+      "failed": true,
+      "msg": te.loop_eval_error.Error(),
+    }
+  }
+
+  // now that we know the task will run, template its args and keywords
+  // with the variables for this host, on our own copy of the task
+  if err := te.Task.PostValidate(templar); err != nil {
+    msg := err.Error()
+    if _, ok := err.(*playbook.UndefinedVariableError); ok {
+      msg = "The task includes an option with an undefined variable. The error was: " + msg
+    }
+    return map[string]interface{} {
+      "changed": false,
+      "failed": true,
+      "msg": msg,
     }
   }
 
-  // FIXME: implement loop eval and context validation error handling here
   // FIXME: include/include_task/include_role handling here
 
   connection := te.GetConnection()
   handler := te.GetActionHandler(connection)
+  return te.runHandler(handler, variables)
+}
 
+// runs the task with the action handler, retrying it until the until
+// condition is met, and applies changed_when and failed_when to the result
+func (te *TaskExecutor) runHandler(handler plugins.ActionInterface, variables map[string]interface{}) map[string]interface{} {
+  // with an until condition the task is attempted
+  // once, and then retried up to retries times
   retries := 1
-  if te.Task.Until() != nil {
+  if len(te.Task.Until()) > 0 {
     retries = te.Task.Retries()
-    if retries < 0 {
+    if retries <= 0 {
       retries = 1
     } else {
       retries += 1
@@ -100,7 +268,7 @@ func (te *TaskExecutor) Execute(vars map[string]interface{}) map[string]interfac
   }
 
   var res map[string]interface{} = nil
-  for i := 1; i < retries + 1; i++ {
+  for attempt := 1; attempt <= retries; attempt++ {
     res = handler.Run(te.Task, variables)
     if te.Task.Register() != "" {
       // FIXME: clean/wrap res here
@@ -126,12 +294,57 @@ func (te *TaskExecutor) Execute(vars map[string]interface{}) map[string]interfac
     if _, ok := res["changed"]; !ok {
       res["changed"] = false
     }
-    // FIXME: do retry handling
-    // FIXME: do changed_when/failed_when handling
-  }
-  if retries > 1 {
-    res["attempts"] = retries + 1
-    res["failed"] = true
+
+    // the result is available under its register name (set above) to
+    // changed_when and failed_when, which replace the changed and failed flags
+    changed_when := te.Task.ChangedWhen()
+    failed_when := te.Task.FailedWhen()
+    skipped, _ := res["skipped"].(bool)
+    if !skipped && (len(changed_when) > 0 || len(failed_when) > 0) {
+      result_templar := playbook.NewTemplar(variables)
+      if len(changed_when) > 0 {
+        changed, _, err := playbook.EvaluateConditionals(changed_when, result_templar)
+        if err != nil {
+          res["failed"] = true
+          res["msg"] = err.Error()
+        } else {
+          res["changed"] = changed
+          res["changed_when_result"] = changed
+        }
+      }
+      if len(failed_when) > 0 {
+        failed, _, err := playbook.EvaluateConditionals(failed_when, result_templar)
+        if err != nil {
+          res["failed"] = true
+          res["msg"] = err.Error()
+        } else {
+          res["failed"] = failed
+          res["failed_when_result"] = failed
+        }
+      }
+    }
+
+    if retries > 1 {
+      res["attempts"] = attempt
+      done, _, err := playbook.EvaluateConditionals(te.Task.Until(), playbook.NewTemplar(variables))
+      if err != nil {
+        res["failed"] = true
+        res["msg"] = err.Error()
+        break
+      }
+      if done {
+        break
+      }
+      if attempt < retries {
+        res["_ansible_retry"] = true
+        res["retries"] = retries
+        te.SendCallback("v2_runner_retry", CallbackArgs{TaskResult{te.Host, te.Task, res}})
+        time.Sleep(time.Duration(delay) * time.Second)
+      } else {
+        // we ran out of attempts without the condition being met
+        res["failed"] = true
+      }
+    }
   }
   // FIXME: wrap ansible_facts in result
   notify := te.Task.Notify()
@@ -164,10 +377,15 @@ func (te *TaskExecutor) GetActionHandler(connection plugins.ConnectionInterface)
   return handler
 }
 
-func NewTaskExecutor(host inventory.Host, task playbook.Task, pc playbook.PlayContext) *TaskExecutor {
+func NewTaskExecutor(host inventory.Host, task playbook.Task, pc playbook.PlayContext, task_vars map[string]interface{}) *TaskExecutor {
   te := new(TaskExecutor)
   te.Host = host
   te.Task = task
   te.PlayContext = pc
+  te.Vars = task_vars
+  if te.Vars == nil {
+    te.Vars = make(map[string]interface{})
+  }
+  te.SendCallback = func(string, ...CallbackArgs) {}
   return te
 }
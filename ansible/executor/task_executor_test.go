@@ -0,0 +1,218 @@
+package executor
+
+import (
+  "reflect"
+  "testing"
+  "github.com/smallfish/simpleyaml"
+  "../inventory"
+  "../playbook"
+  "../plugins"
+)
+
+// an action handler which returns the given results in turn,
+// repeating the last one once they run out
+type fakeAction struct {
+  results []map[string]interface{}
+  calls int
+  connection plugins.ConnectionInterface
+  task playbook.Task
+  args map[string]interface{}
+}
+
+func (a *fakeAction) Run(task playbook.Task, vars map[string]interface{}) map[string]interface{} {
+  i := a.calls
+  if i >= len(a.results) {
+    i = len(a.results) - 1
+  }
+  a.calls += 1
+  res := make(map[string]interface{})
+  for k, v := range a.results[i] {
+    res[k] = v
+  }
+  return res
+}
+
+func (a *fakeAction) Connection() plugins.ConnectionInterface { return a.connection }
+func (a *fakeAction) SetConnection(c plugins.ConnectionInterface) { a.connection = c }
+func (a *fakeAction) Task() playbook.Task { return a.task }
+func (a *fakeAction) SetTask(t playbook.Task) { a.task = t }
+func (a *fakeAction) TaskArgs() map[string]interface{} { return a.args }
+func (a *fakeAction) SetTaskArgs(args map[string]interface{}) { a.args = args }
+
+// loads a task, which may use the debug module
+func loadTask(t *testing.T, data string) *playbook.Task {
+  playbook.ModuleCache["debug"] = playbook.ModuleInfo{Name: "debug.py", Path: "/nonexistent/debug.py"}
+  yaml_data, err := simpleyaml.NewYaml([]byte(data))
+  if err != nil {
+    t.Fatal(err)
+  }
+  task_data, err := yaml_data.Map()
+  if err != nil {
+    t.Fatal(err)
+  }
+  return playbook.NewTask(task_data, nil)
+}
+
+func TestExecuteResult(t *testing.T) {
+  tests := []struct {
+    name string
+    task string
+    results []map[string]interface{}
+    want map[string]interface{}
+    calls int
+  }{
+    {
+      name: "rc of zero succeeds",
+      task: "{debug: {msg: hi}, register: out}",
+      results: []map[string]interface{}{{"rc": 0}},
+      want: map[string]interface{}{"failed": false, "changed": false},
+    },
+    {
+      name: "other rc fails",
+      task: "{debug: {msg: hi}, register: out}",
+      results: []map[string]interface{}{{"rc": 1}},
+      want: map[string]interface{}{"failed": true, "changed": false},
+    },
+    {
+      name: "changed_when met",
+      task: "{debug: {msg: hi}, register: out, changed_when: out.rc == 2, failed_when: out.rc == 3}",
+      results: []map[string]interface{}{{"rc": 2}},
+      want: map[string]interface{}{"failed": false, "changed": true, "changed_when_result": true, "failed_when_result": false},
+    },
+    {
+      name: "changed_when not met",
+      task: "{debug: {msg: hi}, register: out, changed_when: out.rc == 2}",
+      results: []map[string]interface{}{{"rc": 0, "changed": true}},
+      want: map[string]interface{}{"changed": false, "changed_when_result": false},
+    },
+    {
+      name: "failed_when replaces the rc check",
+      task: "{debug: {msg: hi}, register: out, failed_when: out.rc > 1}",
+      results: []map[string]interface{}{{"rc": 1}},
+      want: map[string]interface{}{"failed": false, "failed_when_result": false},
+    },
+    {
+      name: "failed_when met",
+      task: "{debug: {msg: hi}, register: out, failed_when: [out.rc == 0, \"'error' in out.stdout\"]}",
+      results: []map[string]interface{}{{"rc": 0, "stdout": "an error"}},
+      want: map[string]interface{}{"failed": true, "failed_when_result": true},
+    },
+    {
+      name: "failed_when with an undefined variable",
+      task: "{debug: {msg: hi}, register: out, failed_when: missing > 1}",
+      results: []map[string]interface{}{{"rc": 0}},
+      want: map[string]interface{}{"failed": true},
+    },
+    {
+      name: "skipped results are left alone",
+      task: "{debug: {msg: hi}, register: out, changed_when: out.rc == 2}",
+      results: []map[string]interface{}{{"skipped": true}},
+      want: map[string]interface{}{"skipped": true, "changed": false, "failed": false},
+    },
+    {
+      name: "until met",
+      task: "{debug: {msg: hi}, register: out, until: out.count >= 3, retries: 5, delay: 0}",
+      results: []map[string]interface{}{{"count": 1}, {"count": 2}, {"count": 3}},
+      want: map[string]interface{}{"failed": false, "attempts": 3, "count": 3},
+      calls: 3,
+    },
+    {
+      name: "until met the first time",
+      task: "{debug: {msg: hi}, register: out, until: out.count >= 1, retries: 5, delay: 0}",
+      results: []map[string]interface{}{{"count": 1}},
+      want: map[string]interface{}{"failed": false, "attempts": 1},
+      calls: 1,
+    },
+    {
+      name: "until never met",
+      task: "{debug: {msg: hi}, register: out, until: out.count >= 10, retries: 2, delay: 0}",
+      results: []map[string]interface{}{{"count": 1}, {"count": 2}, {"count": 3}},
+      want: map[string]interface{}{"failed": true, "attempts": 3, "count": 3},
+      calls: 3,
+    },
+    {
+      name: "until uses the changed_when result",
+      task: "{debug: {msg: hi}, register: out, changed_when: out.count == 2, until: out is changed, retries: 3, delay: 0}",
+      results: []map[string]interface{}{{"count": 1}, {"count": 2}},
+      want: map[string]interface{}{"failed": false, "changed": true, "attempts": 2},
+      calls: 2,
+    },
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      task := loadTask(t, test.task)
+      te := NewTaskExecutor(*inventory.NewHost("web1", nil), *task, playbook.PlayContext{}, nil)
+      handler := &fakeAction{results: test.results}
+      res := te.runHandler(handler, te.Vars)
+      for k, v := range test.want {
+        if !reflect.DeepEqual(res[k], v) {
+          t.Errorf("got %s=%#v, want %#v in %#v", k, res[k], v, res)
+        }
+      }
+      calls := test.calls
+      if calls == 0 {
+        calls = 1
+      }
+      if handler.calls != calls {
+        t.Errorf("the action ran %d times, want %d", handler.calls, calls)
+      }
+      if !reflect.DeepEqual(te.Vars["out"], res) {
+        t.Errorf("registered %#v, want the result %#v", te.Vars["out"], res)
+      }
+    })
+  }
+}
+
+func TestExecuteRetryCallback(t *testing.T) {
+  task := loadTask(t, "{debug: {msg: hi}, register: out, until: out.count >= 3, retries: 5, delay: 0}")
+  te := NewTaskExecutor(*inventory.NewHost("web1", nil), *task, playbook.PlayContext{}, nil)
+  retries := make([]interface{}, 0)
+  te.SendCallback = func(name string, args ...CallbackArgs) {
+    if name != "v2_runner_retry" {
+      t.Errorf("unexpected callback %s", name)
+      return
+    }
+    retries = append(retries, args[0].what.(TaskResult).Result["attempts"])
+  }
+  handler := &fakeAction{results: []map[string]interface{}{{"count": 1}, {"count": 2}, {"count": 3}}}
+  te.runHandler(handler, te.Vars)
+  if want := []interface{}{1, 2}; !reflect.DeepEqual(retries, want) {
+    t.Errorf("retried after attempts %v, want %v", retries, want)
+  }
+}
+
+func TestRunLoopError(t *testing.T) {
+  tests := []struct {
+    name string
+    task string
+    want map[string]interface{}
+  }{
+    {
+      name: "skipped by the conditional",
+      task: "{debug: {msg: hi}, loop: '{{ foo }}', when: foo is defined}",
+      want: map[string]interface{}{"skipped": true, "changed": false},
+    },
+    {
+      name: "raised when the task runs",
+      task: "{debug: {msg: hi}, loop: '{{ foo }}'}",
+      want: map[string]interface{}{"failed": true, "changed": false, "msg": "'foo' is undefined"},
+    },
+    {
+      name: "not a list",
+      task: "{debug: {msg: hi}, loop: '{{ bar }}', when: bar is defined}",
+      want: map[string]interface{}{"failed": true},
+    },
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      task := loadTask(t, test.task)
+      te := NewTaskExecutor(*inventory.NewHost("web1", nil), *task, playbook.PlayContext{}, map[string]interface{}{"bar": "x"})
+      res := te.Run().Result
+      for k, v := range test.want {
+        if !reflect.DeepEqual(res[k], v) {
+          t.Errorf("got %s=%#v, want %#v in %#v", k, res[k], v, res)
+        }
+      }
+    })
+  }
+}
@@ -2,8 +2,10 @@ package executor
 
 import (
   "fmt"
+  "sync"
   "../inventory"
   "../playbook"
+  "../vars"
 )
 
 const TQM_RUN_OK = 0
@@ -21,6 +23,7 @@ type WorkerJob struct {
   Host inventory.Host
   Task playbook.Task
   PlayContext playbook.PlayContext
+  Vars map[string]interface{}
 }
 
 type CallbackArgs struct {
@@ -29,24 +32,31 @@ type CallbackArgs struct {
 
 type TaskQueueManager struct {
   Inventory *inventory.InventoryManager
-  VarManager interface{} // FIXME
+  VarManager *vars.VariableManager
   Options interface{} // FIXME
   Stats interface{} // FIXME
   Passwords []string
   Terminated bool
   StartAtDone bool
-  // handler mappings for notifications
-  NotifiedHandlers map[string][]inventory.Host
-  ListeningHandlers map[string][]inventory.Host
+  // handler mappings for notifications, the hosts which have notified
+  // each handler and the handlers listening to each topic, the handlers
+  // are given by their position in the play as names may be repeated
+  NotifiedHandlers map[int][]inventory.Host
+  ListeningHandlers map[string][]int
   // maps to track failed and unreachable hosts
   FailedHosts map[string]bool
   UnreachableHosts map[string]bool
   // private stuff
+  handlers []playbook.Task
+  handler_names map[string]int
+  iterator *PlayIterator
   std_out_callback interface{} // FIXME
   callbacks_loaded bool
   callback_plugins []interface{} // FIXME
   run_additional_callbacks bool
-  // go routine stuff
+  // go routine stuff, the workers send callbacks
+  // too so they are sent one at a time
+  callback_lock sync.Mutex
   workers []WorkerSlot
   work_queue chan WorkerJob
   result_queue chan TaskResult
@@ -57,7 +67,21 @@ func (tqm *TaskQueueManager) LoadCallbacks() {
 }
 
 func (tqm *TaskQueueManager) SendCallback(name string, args ...CallbackArgs) {
-
+  tqm.callback_lock.Lock()
+  defer tqm.callback_lock.Unlock()
+  // FIXME: there are no callback plugins yet, so the
+  // output for the callbacks which need it is here
+  switch name {
+  case "v2_runner_retry":
+    res := args[0].what.(TaskResult)
+    task_name := res.Task.Name()
+    if task_name == "" {
+      task_name = res.Task.Action()
+    }
+    retries, _ := res.Result["retries"].(int)
+    attempts, _ := res.Result["attempts"].(int)
+    fmt.Printf("FAILED - RETRYING: [%s]: %s (%d retries left).\n", res.Host.Name, task_name, retries-attempts)
+  }
 }
 
 func (tqm *TaskQueueManager) Run(play *playbook.Play) int {
@@ -75,40 +99,197 @@ func (tqm *TaskQueueManager) Run(play *playbook.Play) int {
   //    callback_plugin.set_play_context(play_context)
   tqm.SendCallback("v2_playbook_on_play_start", CallbackArgs{play})
   // initialize the shared dictionary containing the notified handlers
-  //self._initialize_notified_handlers(new_play)
+  tqm.initializeNotifiedHandlers(play)
   iterator := NewPlayIterator(tqm, play, play_context, make(map[string]interface{}))
-  host := tqm.Inventory.GetHosts()[0]
+  tqm.iterator = iterator
+  hosts := tqm.Inventory.GetHosts(play.Hosts())
 
-  pending_tasks := 0
-  for s, t := iterator.GetNextTaskForHost(host, false); s.RunState != ITERATING_COMPLETE; s, t = iterator.GetNextTaskForHost(host, false) {
-    if t.Action() == "meta" {
-      fmt.Println("META TASK:", t)
-    } else {
-      tqm.QueueTask(host, *t, *play_context)
-      pending_tasks += 1
-      for pending_tasks > 0 {
-        res := <-tqm.result_queue
-        fmt.Println(res)
-        pending_tasks -= 1
+  // step all of the hosts through the play together, one task at a
+  // time, waiting for every host to finish before moving on
+  work_to_do := true
+  for work_to_do {
+    work_to_do = false
+    meta_hosts := make([]inventory.Host, 0)
+    meta_tasks := make([]*playbook.Task, 0)
+    pending_tasks := 0
+    for _, host := range hosts {
+      s, t := iterator.GetNextTaskForHost(host, false)
+      if s.RunState == ITERATING_COMPLETE || t == nil {
+        continue
+      }
+      work_to_do = true
+      if t.Action() == "meta" {
+        meta_hosts = append(meta_hosts, host)
+        meta_tasks = append(meta_tasks, t)
+        continue
       }
+      tqm.queueHostTask(play, play_context, host, t)
+      pending_tasks += 1
+    }
+    tqm.waitForResults(pending_tasks)
+    if len(meta_tasks) > 0 {
+      tqm.runMetaTasks(iterator, play, play_context, meta_hosts, meta_tasks)
+      // the inventory may have been refreshed
+      hosts = tqm.Inventory.GetHosts(play.Hosts())
     }
   }
-  fmt.Println("TASK ITERATION COMPLETE FOR HOST: ", host)
+  for _, host := range hosts {
+    fmt.Println("TASK ITERATION COMPLETE FOR HOST: ", host)
+  }
   return TQM_RUN_OK
 }
 
-func (tqm *TaskQueueManager) QueueTask(host inventory.Host, task playbook.Task, play_context playbook.PlayContext) {
-  job := WorkerJob{host, task, play_context}
+// queues the task to run on the host, the result
+// of which is read back with waitForResults
+func (tqm *TaskQueueManager) queueHostTask(play *playbook.Play, play_context *playbook.PlayContext, host inventory.Host, t *playbook.Task) {
+  // the vars are built here rather than in the workers, since
+  // they depend on the results processed in waitForResults
+  task_vars, err := tqm.VarManager.GetVars(play, &host, t)
+  if err != nil {
+    failed := TaskResult{host, *t, map[string]interface{}{"failed": true, "msg": err.Error()}}
+    go func() { tqm.result_queue <- failed }()
+  } else {
+    // queued in the background, as the queue may fill up before
+    // we start reading results back off of the result queue
+    go tqm.QueueTask(host, *t, *play_context, task_vars)
+  }
+}
+
+func (tqm *TaskQueueManager) waitForResults(pending_tasks int) {
+  for pending_tasks > 0 {
+    res := <-tqm.result_queue
+    fmt.Println(res)
+    tqm.ProcessResult(res)
+    pending_tasks -= 1
+  }
+}
+
+// handlers are notified by their name, or by any topic they listen to
+func (tqm *TaskQueueManager) initializeNotifiedHandlers(play *playbook.Play) {
+  tqm.handlers = make([]playbook.Task, 0)
+  for i := range play.Handlers {
+    tqm.handlers = append(tqm.handlers, play.Handlers[i].GetTasks()...)
+  }
+  tqm.NotifiedHandlers = make(map[int][]inventory.Host)
+  tqm.ListeningHandlers = make(map[string][]int)
+  tqm.handler_names = make(map[string]int)
+  for i := range tqm.handlers {
+    // when handlers share a name, the first of them is notified by it
+    handler_name := tqm.handlers[i].HandlerName()
+    if _, ok := tqm.handler_names[handler_name]; !ok {
+      tqm.handler_names[handler_name] = i
+    }
+    tqm.NotifiedHandlers[i] = make([]inventory.Host, 0)
+    for _, topic := range tqm.handlers[i].Listen() {
+      tqm.ListeningHandlers[topic] = append(tqm.ListeningHandlers[topic], i)
+    }
+  }
+}
+
+// adds the host to those which have notified the handler,
+// so that the handler is only run once for each host
+func (tqm *TaskQueueManager) notifyHandler(handler int, host inventory.Host) {
+  for _, notified_host := range tqm.NotifiedHandlers[handler] {
+    if notified_host.Name == host.Name {
+      return
+    }
+  }
+  tqm.NotifiedHandlers[handler] = append(tqm.NotifiedHandlers[handler], host)
+}
+
+// RunHandlers runs every notified handler, in the order they are defined
+// in the play, on the given hosts which notified it. Handlers may notify
+// the handlers which come after them, which are then run in the same flush.
+func (tqm *TaskQueueManager) RunHandlers(play *playbook.Play, play_context *playbook.PlayContext, hosts []inventory.Host) {
+  for i := range tqm.handlers {
+    handler := tqm.handlers[i]
+    // any other hosts stay notified until they reach a flush
+    notified_hosts := make([]inventory.Host, 0)
+    still_notified := make([]inventory.Host, 0)
+    for _, notified_host := range tqm.NotifiedHandlers[i] {
+      flushed := false
+      for _, host := range hosts {
+        flushed = flushed || host.Name == notified_host.Name
+      }
+      if flushed {
+        notified_hosts = append(notified_hosts, notified_host)
+      } else {
+        still_notified = append(still_notified, notified_host)
+      }
+    }
+    if len(notified_hosts) == 0 {
+      continue
+    }
+    tqm.NotifiedHandlers[i] = still_notified
+    tqm.SendCallback("v2_playbook_on_handler_task_start", CallbackArgs{handler})
+    for _, host := range notified_hosts {
+      tqm.queueHostTask(play, play_context, host, &handler)
+    }
+    tqm.waitForResults(len(notified_hosts))
+  }
+}
+
+// saves anything from the result which later tasks may use,
+// such as a registered result or any facts which were returned
+func (tqm *TaskQueueManager) ProcessResult(res TaskResult) {
+  if register := res.Task.Register(); register != "" {
+    tqm.VarManager.SetNonpersistentFacts(res.Host.Name, map[string]interface{}{register: res.Result})
+  }
+  if facts, ok := res.Result["ansible_facts"].(map[string]interface{}); ok {
+    if res.Task.Action() == "set_fact" {
+      tqm.VarManager.SetNonpersistentFacts(res.Host.Name, facts)
+    } else {
+      tqm.VarManager.SetHostFacts(res.Host.Name, facts)
+    }
+  }
+  // only a successful change notifies the handlers
+  changed, _ := res.Result["changed"].(bool)
+  failed, _ := res.Result["failed"].(bool)
+  // an unreachable host runs no more tasks, while a failed host moves
+  // on to any rescue section and only counts as failed without one
+  if unreachable, _ := res.Result["unreachable"].(bool); unreachable {
+    tqm.UnreachableHosts[res.Host.Name] = true
+    tqm.iterator.EndHost(res.Host)
+  } else if failed && !res.Task.IgnoreErrors() {
+    tqm.iterator.MarkHostFailed(res.Host)
+    if tqm.iterator.IsFailed(res.Host) {
+      tqm.FailedHosts[res.Host.Name] = true
+    }
+  }
+  if notify, ok := res.Result["_ansible_notify"].([]string); ok && changed && !failed {
+    for _, notification := range notify {
+      handler, found := tqm.handler_names[notification]
+      if found {
+        tqm.notifyHandler(handler, res.Host)
+      }
+      if listeners, ok := tqm.ListeningHandlers[notification]; ok {
+        found = true
+        for _, listener := range listeners {
+          tqm.notifyHandler(listener, res.Host)
+        }
+      }
+      if !found {
+        fmt.Printf("[WARNING]: The requested handler '%s' was not found in either the main handlers list nor in the listening handlers list\n", notification)
+      }
+    }
+  }
+}
+
+func (tqm *TaskQueueManager) QueueTask(host inventory.Host, task playbook.Task, play_context playbook.PlayContext, task_vars map[string]interface{}) {
+  job := WorkerJob{host, task, play_context, task_vars}
   tqm.work_queue <- job
   fmt.Println("- queued task")
 }
 
-func NewTaskQueueManager(inventory *inventory.InventoryManager, run_additional_callbacks bool) *TaskQueueManager {
+func NewTaskQueueManager(inventory *inventory.InventoryManager, variable_manager *vars.VariableManager, run_additional_callbacks bool) *TaskQueueManager {
   tqm := new(TaskQueueManager)
   tqm.Inventory = inventory
+  tqm.VarManager = variable_manager
   tqm.Terminated = false
   tqm.StartAtDone = false
   tqm.callbacks_loaded = false
+  tqm.FailedHosts = make(map[string]bool)
+  tqm.UnreachableHosts = make(map[string]bool)
   tqm.run_additional_callbacks = run_additional_callbacks
   tqm.work_queue = make(chan WorkerJob, 5)
   tqm.result_queue = make(chan TaskResult, 5)
@@ -119,7 +300,8 @@ func NewTaskQueueManager(inventory *inventory.InventoryManager, run_additional_c
     // fan-out to the workers
     go func() {
       for n := range tqm.work_queue {
-        te := NewTaskExecutor(n.Host, n.Task, n.PlayContext)
+        te := NewTaskExecutor(n.Host, n.Task, n.PlayContext, n.Vars)
+        te.SendCallback = tqm.SendCallback
         res_chan <- te.Run()
       }
     }()
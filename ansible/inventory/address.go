@@ -0,0 +1,194 @@
+package inventory
+
+import (
+  "fmt"
+  "net"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+var bracketed_hostport_re = regexp.MustCompile(`^\[([^\]]+)\]:([0-9]+)$`)
+var ascii_letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// DetectRange returns true if the host name contains a [x:y] range
+func DetectRange(pattern string) bool {
+  open := strings.Index(pattern, "[")
+  colon := strings.Index(pattern, ":")
+  close := strings.Index(pattern, "]")
+  return open != -1 && open < colon && colon < close
+}
+
+// ExpandHostnameRange expands the first [begin:end(:step)] range in the
+// name, recursing for any further ranges. Numeric ranges keep any leading
+// zeros ("web[01:10]"), and single letters give alphabetic ranges ("db-[a:f]").
+func ExpandHostnameRange(pattern string) ([]string, error) {
+  open := strings.Index(pattern, "[")
+  close := strings.Index(pattern, "]")
+  if open == -1 || close < open {
+    return []string{pattern}, nil
+  }
+  head := pattern[:open]
+  nrange := pattern[open+1:close]
+  tail := pattern[close+1:]
+
+  bounds := strings.Split(nrange, ":")
+  if len(bounds) != 2 && len(bounds) != 3 {
+    return nil, fmt.Errorf("host range must be begin:end or begin:end:step")
+  }
+  beg := bounds[0]
+  end := bounds[1]
+  step := 1
+  if len(bounds) == 3 && bounds[2] != "" {
+    s, err := strconv.Atoi(bounds[2])
+    if err != nil || s < 1 {
+      return nil, fmt.Errorf("host range step must be a positive integer: %s", bounds[2])
+    }
+    step = s
+  }
+  if beg == "" {
+    beg = "0"
+  }
+  if end == "" {
+    return nil, fmt.Errorf("host range must specify end value")
+  }
+
+  seq := make([]string, 0)
+  i_beg := strings.Index(ascii_letters, beg)
+  i_end := strings.Index(ascii_letters, end)
+  if len(beg) == 1 && len(end) == 1 && i_beg != -1 && i_end != -1 {
+    if i_beg > i_end {
+      return nil, fmt.Errorf("host range must have begin <= end")
+    }
+    for i := i_beg; i <= i_end; i += step {
+      seq = append(seq, string(ascii_letters[i]))
+    }
+  } else {
+    n_beg, err := strconv.Atoi(beg)
+    if err != nil {
+      return nil, fmt.Errorf("host range must be numeric or a single letter: %s", nrange)
+    }
+    n_end, err := strconv.Atoi(end)
+    if err != nil {
+      return nil, fmt.Errorf("host range must be numeric or a single letter: %s", nrange)
+    }
+    if n_beg > n_end {
+      return nil, fmt.Errorf("host range must have begin <= end")
+    }
+    format := "%d"
+    if beg[0] == '0' && len(beg) > 1 {
+      if len(beg) != len(end) {
+        return nil, fmt.Errorf("host range must specify equal-length begin and end formats")
+      }
+      format = "%0" + strconv.Itoa(len(beg)) + "d"
+    }
+    for i := n_beg; i <= n_end; i += step {
+      seq = append(seq, fmt.Sprintf(format, i))
+    }
+  }
+
+  hosts := make([]string, 0)
+  for _, r := range seq {
+    name := head + r + tail
+    if DetectRange(name) {
+      expanded, err := ExpandHostnameRange(name)
+      if err != nil {
+        return nil, err
+      }
+      hosts = append(hosts, expanded...)
+    } else {
+      hosts = append(hosts, name)
+    }
+  }
+  return hosts, nil
+}
+
+// ParseAddress splits an address into the host and the port (or -1 if
+// none was given). IPv6 addresses must be bracketed to be given a port,
+// as in "[::1]:2222". When allow_ranges is set, the host may contain
+// [x:y] ranges, which are left for ExpandHostnameRange() to expand.
+func ParseAddress(address string, allow_ranges bool) (string, int, error) {
+  host := address
+  port := -1
+  if m := bracketed_hostport_re.FindStringSubmatch(address); m != nil {
+    host = m[1]
+    p, err := parsePort(m[2])
+    if err != nil {
+      return "", -1, fmt.Errorf("Invalid port in address %s: %s", address, err)
+    }
+    port = p
+  } else if ip := net.ParseIP(address); ip != nil {
+    // a bare IPv4 or IPv6 address without a port
+    return address, -1, nil
+  } else {
+    // the port is after the last colon which is not inside of a range
+    depth := 0
+    last_colon := -1
+    for i, c := range address {
+      switch c {
+      case '[':
+        depth += 1
+      case ']':
+        depth -= 1
+      case ':':
+        if depth == 0 {
+          if last_colon != -1 {
+            return "", -1, fmt.Errorf("Not a valid network hostname: %s", address)
+          }
+          last_colon = i
+        }
+      }
+    }
+    if last_colon != -1 {
+      p, err := parsePort(address[last_colon+1:])
+      if err != nil {
+        return "", -1, fmt.Errorf("Invalid port in address %s: %s", address, err)
+      }
+      host = address[:last_colon]
+      port = p
+    }
+  }
+
+  if host == "" {
+    return "", -1, fmt.Errorf("Not a valid network hostname: %s", address)
+  }
+  if DetectRange(host) && !allow_ranges {
+    return "", -1, fmt.Errorf("Detected range in host but was asked to ignore ranges: %s", address)
+  }
+  return host, port, nil
+}
+
+func parsePort(port string) (int, error) {
+  p, err := strconv.Atoi(port)
+  if err != nil || p < 0 || p > 65535 {
+    return -1, fmt.Errorf("'%s' is not a valid port", port)
+  }
+  return p, nil
+}
+
+// AddHostPattern expands a host pattern such as "web[01:10].example.com:2222"
+// and adds each of the resulting hosts to the inventory (and group). When a
+// port is given it is set as ansible_port, with the address as ansible_host.
+func (im *InventoryManager) AddHostPattern(pattern string, group string) ([]*Host, error) {
+  address, port, err := ParseAddress(pattern, true)
+  if err != nil {
+    return nil, err
+  }
+  names := []string{address}
+  if DetectRange(address) {
+    if names, err = ExpandHostnameRange(address); err != nil {
+      return nil, fmt.Errorf("%s: %s", pattern, err)
+    }
+  }
+
+  hosts := make([]*Host, 0, len(names))
+  for _, name := range names {
+    host := im.AddHost(name, group)
+    if port != -1 {
+      host.SetVariable("ansible_host", name)
+      host.SetVariable("ansible_port", port)
+    }
+    hosts = append(hosts, host)
+  }
+  return hosts, nil
+}
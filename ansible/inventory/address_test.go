@@ -0,0 +1,81 @@
+package inventory
+
+import (
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestExpandHostnameRange(t *testing.T) {
+  tests := []struct {
+    pattern string
+    want []string
+    err string
+  }{
+    {"web", []string{"web"}, ""},
+    {"web[1:3]", []string{"web1", "web2", "web3"}, ""},
+    {"web[01:03].example.com", []string{"web01.example.com", "web02.example.com", "web03.example.com"}, ""},
+    {"web[:2]", []string{"web0", "web1", "web2"}, ""},
+    {"web[0:6:2]", []string{"web0", "web2", "web4", "web6"}, ""},
+    {"db-[a:c]", []string{"db-a", "db-b", "db-c"}, ""},
+    {"db-[a:e:2]", []string{"db-a", "db-c", "db-e"}, ""},
+    {"[a:b][1:2]", []string{"a1", "a2", "b1", "b2"}, ""},
+    {"web[1:2:3:4]", nil, "host range must be begin:end or begin:end:step"},
+    {"web[1:]", nil, "host range must specify end value"},
+    {"web[3:1]", nil, "host range must have begin <= end"},
+    {"db-[c:a]", nil, "host range must have begin <= end"},
+    {"web[1:3:0]", nil, "host range step must be a positive integer"},
+    {"web[01:100]", nil, "host range must specify equal-length begin and end formats"},
+    {"web[a:10]", nil, "host range must be numeric or a single letter"},
+  }
+  for _, test := range tests {
+    got, err := ExpandHostnameRange(test.pattern)
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("ExpandHostnameRange(%q): expected an error containing %q, got %v", test.pattern, test.err, err)
+      }
+    } else if err != nil {
+      t.Errorf("ExpandHostnameRange(%q): unexpected error: %s", test.pattern, err)
+    } else if !reflect.DeepEqual(got, test.want) {
+      t.Errorf("ExpandHostnameRange(%q) = %v, want %v", test.pattern, got, test.want)
+    }
+  }
+}
+
+func TestParseAddress(t *testing.T) {
+  tests := []struct {
+    address string
+    allow_ranges bool
+    host string
+    port int
+    err string
+  }{
+    {"example.com", false, "example.com", -1, ""},
+    {"example.com:2222", false, "example.com", 2222, ""},
+    {"192.168.0.1", false, "192.168.0.1", -1, ""},
+    {"192.168.0.1:22", false, "192.168.0.1", 22, ""},
+    {"::1", false, "::1", -1, ""},
+    {"fe80::1", false, "fe80::1", -1, ""},
+    {"[::1]:2222", false, "::1", 2222, ""},
+    {"web[1:3].example.com", true, "web[1:3].example.com", -1, ""},
+    {"web[1:3].example.com:2222", true, "web[1:3].example.com", 2222, ""},
+    {"web[1:3].example.com", false, "", -1, "Detected range in host but was asked to ignore ranges"},
+    {"example.com:port", false, "", -1, "Invalid port in address"},
+    {"example.com:70000", false, "", -1, "Invalid port in address"},
+    {"[::1]:99999", false, "", -1, "Invalid port in address"},
+    {"a:b:c", false, "", -1, "Not a valid network hostname"},
+    {":22", false, "", -1, "Not a valid network hostname"},
+  }
+  for _, test := range tests {
+    host, port, err := ParseAddress(test.address, test.allow_ranges)
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("ParseAddress(%q): expected an error containing %q, got %v", test.address, test.err, err)
+      }
+    } else if err != nil {
+      t.Errorf("ParseAddress(%q): unexpected error: %s", test.address, err)
+    } else if host != test.host || port != test.port {
+      t.Errorf("ParseAddress(%q) = %q, %d, want %q, %d", test.address, host, port, test.host, test.port)
+    }
+  }
+}
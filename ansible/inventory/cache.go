@@ -0,0 +1,205 @@
+package inventory
+
+import (
+  "bytes"
+  "crypto/sha1"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// the default number of seconds a cached inventory is used for
+const DefaultInventoryCacheTimeout = 3600
+
+// InventoryCache keeps the parsed inventory on disk, so that slow sources
+// (such as dynamic inventory scripts) are not run again for every command.
+// Each combination of sources and enabled plugins has its own cache file.
+type InventoryCache struct {
+  Dir string
+  // how long a cached inventory is used for, zero means it never expires
+  Timeout time.Duration
+  // when set the cache is never read, but it is still updated
+  Flush bool
+}
+
+// the cache file format, hosts and groups are lists so
+// that the inventory order is kept when it is loaded
+type cachedInventory struct {
+  Hosts []cachedHost `json:"hosts"`
+  Groups []cachedGroup `json:"groups"`
+}
+
+type cachedHost struct {
+  Name string `json:"name"`
+  Vars map[string]interface{} `json:"vars"`
+}
+
+type cachedGroup struct {
+  Name string `json:"name"`
+  Vars map[string]interface{} `json:"vars"`
+  Children []string `json:"children"`
+  Hosts []string `json:"hosts"`
+}
+
+// InventoryCacheEnabled returns whether ANSIBLE_INVENTORY_CACHE turns
+// on the inventory cache, which is off by default
+func InventoryCacheEnabled() bool {
+  switch strings.ToLower(os.Getenv("ANSIBLE_INVENTORY_CACHE")) {
+  case "1", "true", "yes", "on":
+    return true
+  }
+  return false
+}
+
+// DefaultInventoryCache returns the cache configured with the environment,
+// whether or not it is enabled. The directory is set with
+// ANSIBLE_INVENTORY_CACHE_CONNECTION and the number of seconds to keep
+// entries for with ANSIBLE_INVENTORY_CACHE_TIMEOUT.
+func DefaultInventoryCache() (*InventoryCache, error) {
+  dir := os.Getenv("ANSIBLE_INVENTORY_CACHE_CONNECTION")
+  if dir == "" {
+    dir = filepath.Join(os.Getenv("HOME"), ".ansible", "cache", "inventory")
+  }
+  timeout := DefaultInventoryCacheTimeout
+  if value := os.Getenv("ANSIBLE_INVENTORY_CACHE_TIMEOUT"); value != "" {
+    t, err := strconv.Atoi(value)
+    if err != nil || t < 0 {
+      return nil, fmt.Errorf("Invalid ANSIBLE_INVENTORY_CACHE_TIMEOUT: %s", value)
+    }
+    timeout = t
+  }
+  return NewInventoryCache(dir, time.Duration(timeout) * time.Second), nil
+}
+
+// the cache key covers everything which changes what is parsed,
+// which is the sources themselves and the plugins used to parse them
+func (c *InventoryCache) path(im *InventoryManager) string {
+  hash := sha1.New()
+  for _, source := range im.Sources {
+    if abs, err := filepath.Abs(source); err == nil {
+      if _, err := os.Stat(abs); err == nil {
+        source = abs
+      }
+    }
+    fmt.Fprintf(hash, "source:%s\n", source)
+  }
+  for _, p := range im.plugins {
+    fmt.Fprintf(hash, "plugin:%s\n", p.name)
+  }
+  return filepath.Join(c.Dir, hex.EncodeToString(hash.Sum(nil)) + ".json")
+}
+
+// Load reads the cached inventory into im, returning false if there is
+// no usable cache entry. A broken cache entry is only a warning, since
+// the inventory can always be parsed again.
+func (c *InventoryCache) Load(im *InventoryManager) bool {
+  if c.Flush {
+    return false
+  }
+  path := c.path(im)
+  info, err := os.Stat(path)
+  if err != nil {
+    return false
+  }
+  if c.Timeout > 0 && time.Since(info.ModTime()) > c.Timeout {
+    return false
+  }
+  data, err := ioutil.ReadFile(path)
+  if err != nil {
+    fmt.Println("[WARNING]: Could not read the inventory cache:", err)
+    return false
+  }
+  var cached cachedInventory
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  decoder.UseNumber()
+  if err := decoder.Decode(&cached); err != nil {
+    fmt.Println("[WARNING]: Ignoring invalid inventory cache", path, ":", err)
+    return false
+  }
+
+  for _, group := range cached.Groups {
+    g := im.AddGroup(group.Name)
+    for k, v := range group.Vars {
+      g.SetVariable(k, NormalizeValue(v))
+    }
+  }
+  for _, host := range cached.Hosts {
+    h := im.AddHost(host.Name, "")
+    for k, v := range host.Vars {
+      h.SetVariable(k, NormalizeValue(v))
+    }
+  }
+  for _, group := range cached.Groups {
+    for _, child := range group.Children {
+      if err := im.AddChildGroup(group.Name, child); err != nil {
+        fmt.Println("[WARNING]: Ignoring invalid inventory cache", path, ":", err)
+        return false
+      }
+    }
+    for _, host := range group.Hosts {
+      im.AddHost(host, group.Name)
+    }
+  }
+  return true
+}
+
+// Save writes the current inventory to the cache
+func (c *InventoryCache) Save(im *InventoryManager) error {
+  cached := cachedInventory{
+    Hosts: make([]cachedHost, 0, len(im.host_order)),
+    Groups: make([]cachedGroup, 0, len(im.group_order)),
+  }
+  for _, name := range im.host_order {
+    cached.Hosts = append(cached.Hosts, cachedHost{name, im.Hosts[name].Vars})
+  }
+  for _, name := range im.group_order {
+    group := im.Groups[name]
+    g := cachedGroup{name, group.Vars, make([]string, 0), make([]string, 0)}
+    for _, child := range group.ChildGroups {
+      g.Children = append(g.Children, child.Name)
+    }
+    for _, host := range group.Hosts {
+      g.Hosts = append(g.Hosts, host.Name)
+    }
+    cached.Groups = append(cached.Groups, g)
+  }
+
+  data, err := json.Marshal(cached)
+  if err != nil {
+    return err
+  }
+  if err := os.MkdirAll(c.Dir, 0700); err != nil {
+    return err
+  }
+  // write to a temporary file first, so a concurrent run
+  // never reads a partially written cache file
+  path := c.path(im)
+  tmp, err := ioutil.TempFile(c.Dir, ".inventory")
+  if err != nil {
+    return err
+  }
+  if _, err := tmp.Write(data); err != nil {
+    tmp.Close()
+    os.Remove(tmp.Name())
+    return err
+  }
+  if err := tmp.Close(); err != nil {
+    os.Remove(tmp.Name())
+    return err
+  }
+  return os.Rename(tmp.Name(), path)
+}
+
+func NewInventoryCache(dir string, timeout time.Duration) *InventoryCache {
+  c := new(InventoryCache)
+  c.Dir = dir
+  c.Timeout = timeout
+  c.Flush = false
+  return c
+}
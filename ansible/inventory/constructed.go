@@ -0,0 +1,244 @@
+package inventory
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "sort"
+)
+
+var unsafe_group_chars_re = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// TemplateExpression renders a jinja2 expression (without the surrounding
+// {{ }}) against the given variables, and EvaluateExpression evaluates one
+// the same way as a "when" clause. These are set from main to use the
+// playbook Templar, so constructed sources have the same filters, tests
+// and lookups as tasks do.
+var TemplateExpression func(expr string, vars map[string]interface{}) (interface{}, error)
+var EvaluateExpression func(expr string, vars map[string]interface{}) (bool, error)
+
+// a group created from the value of an expression, for example
+// {key: os_family, prefix: os} puts a Debian host in "os_Debian"
+type KeyedGroup struct {
+  Key string
+  Prefix string
+  Separator string
+  ParentGroup string
+  DefaultValue string
+}
+
+// ConstructedConfig is a YAML inventory source with "plugin: constructed",
+// which creates vars and groups from the vars of the hosts loaded by the
+// other sources:
+//
+//   plugin: constructed
+//   strict: false
+//   compose:
+//     ansible_port: 2222 if 'bastion' in group_names else 22
+//   groups:
+//     webservers: "'web' in inventory_hostname"
+//   keyed_groups:
+//     - key: os_family
+//       prefix: os
+//
+// These are only applied once every other source has been loaded (see
+// ApplyConstructed), so the order of the sources does not matter.
+type ConstructedConfig struct {
+  Path string
+  // when set, expressions which fail to evaluate are an error
+  // instead of being skipped for that host
+  Strict bool
+  Compose map[string]string
+  Groups map[string]string
+  KeyedGroups []KeyedGroup
+}
+
+func IsConstructedConfig(data map[interface{}]interface{}) bool {
+  plugin, _ := data["plugin"].(string)
+  return plugin == "constructed"
+}
+
+func ParseConstructedConfig(path string, data map[interface{}]interface{}, im *InventoryManager) error {
+  config := new(ConstructedConfig)
+  config.Path = path
+  config.Compose = make(map[string]string)
+  config.Groups = make(map[string]string)
+  config.KeyedGroups = make([]KeyedGroup, 0)
+
+  for k, _ := range data {
+    switch key, _ := k.(string); key {
+    case "plugin", "strict", "compose", "groups", "keyed_groups":
+    default:
+      fmt.Printf("[WARNING]: Skipping unexpected key (%v) in constructed inventory %s\n", k, path)
+    }
+  }
+
+  if strict, ok := data["strict"]; ok {
+    if config.Strict, ok = strict.(bool); !ok {
+      return fmt.Errorf("%s: strict must be a boolean", path)
+    }
+  }
+  for _, section := range []string{"compose", "groups"} {
+    values, err := yamlSection(data[section])
+    if err != nil {
+      return fmt.Errorf("%s: Invalid %s: %s", path, section, err)
+    }
+    for k, v := range values {
+      expr := fmt.Sprintf("%v", v)
+      if section == "compose" {
+        config.Compose[k] = expr
+      } else {
+        config.Groups[k] = expr
+      }
+    }
+  }
+  if keyed_groups, ok := data["keyed_groups"]; ok && keyed_groups != nil {
+    list, ok := keyed_groups.([]interface{})
+    if !ok {
+      return fmt.Errorf("%s: keyed_groups must be a list", path)
+    }
+    for _, entry := range list {
+      values, err := yamlSection(entry)
+      if err != nil {
+        return fmt.Errorf("%s: Invalid keyed_groups entry: %s", path, err)
+      }
+      kg := KeyedGroup{Separator: "_"}
+      for k, v := range values {
+        value := fmt.Sprintf("%v", v)
+        switch k {
+        case "key":
+          kg.Key = value
+        case "prefix":
+          kg.Prefix = value
+        case "separator":
+          kg.Separator = value
+        case "parent_group":
+          kg.ParentGroup = value
+        case "default_value":
+          kg.DefaultValue = value
+        default:
+          return fmt.Errorf("%s: Invalid keyed_groups option: %s", path, k)
+        }
+      }
+      if kg.Key == "" {
+        return fmt.Errorf("%s: Every keyed_groups entry must have a key", path)
+      }
+      config.KeyedGroups = append(config.KeyedGroups, kg)
+    }
+  }
+
+  im.constructed = append(im.constructed, config)
+  return nil
+}
+
+// ApplyConstructed runs every constructed config against every host, in
+// the order the configs were loaded. For each host the composed vars are
+// set first, so that they can be used by the groups and keyed_groups.
+func (im *InventoryManager) ApplyConstructed() error {
+  for _, config := range im.constructed {
+    for _, name := range im.host_order {
+      if err := config.apply(im, im.Hosts[name]); err != nil {
+        return fmt.Errorf("%s: %s", config.Path, err)
+      }
+    }
+  }
+  return nil
+}
+
+func (config *ConstructedConfig) apply(im *InventoryManager, host *Host) error {
+  if TemplateExpression == nil || EvaluateExpression == nil {
+    return errors.New("constructed sources can not be used without a templar")
+  }
+  vars := host.GetVars()
+  for _, key := range sortedStringKeys(config.Compose) {
+    res, err := TemplateExpression(config.Compose[key], vars)
+    if err != nil {
+      if config.Strict {
+        return fmt.Errorf("Could not set %s for host %s: %s", key, host.Name, err)
+      }
+      continue
+    }
+    host.SetVariable(key, res)
+  }
+
+  vars = host.GetVars()
+  for _, group := range sortedStringKeys(config.Groups) {
+    res, err := EvaluateExpression(config.Groups[group], vars)
+    if err != nil {
+      if config.Strict {
+        return fmt.Errorf("Could not add host %s to group %s: %s", host.Name, group, err)
+      }
+      continue
+    }
+    if res {
+      im.AddHost(host.Name, group)
+    }
+  }
+
+  for _, kg := range config.KeyedGroups {
+    res, err := TemplateExpression(kg.Key, vars)
+    if err == nil && (res == nil || res == "") {
+      res = kg.DefaultValue
+      if res == "" {
+        err = errors.New("the key resulted in an empty value")
+      }
+    }
+    if err != nil {
+      if config.Strict {
+        return fmt.Errorf("Could not generate keyed group from %s for host %s: %s", kg.Key, host.Name, err)
+      }
+      continue
+    }
+    for _, name := range kg.groupNames(res) {
+      im.AddHost(host.Name, name)
+      if kg.ParentGroup != "" {
+        if err := im.AddChildGroup(kg.ParentGroup, name); err != nil {
+          return err
+        }
+      }
+    }
+  }
+  return nil
+}
+
+// a list value gives a group for each item and a dictionary
+// gives a group for each key/value pair
+func (kg KeyedGroup) groupNames(value interface{}) []string {
+  keys := make([]string, 0)
+  switch v := value.(type) {
+  case []interface{}:
+    for _, item := range v {
+      keys = append(keys, fmt.Sprintf("%v", item))
+    }
+  case map[string]interface{}:
+    for _, k := range sortedKeys(v) {
+      keys = append(keys, k + kg.Separator + fmt.Sprintf("%v", v[k]))
+    }
+  default:
+    keys = append(keys, fmt.Sprintf("%v", v))
+  }
+
+  names := make([]string, 0, len(keys))
+  for _, key := range keys {
+    name := key
+    if kg.Prefix != "" {
+      name = kg.Prefix + kg.Separator + key
+    }
+    names = append(names, SafeGroupName(name))
+  }
+  return names
+}
+
+// replaces anything which is not valid in a group name with an underscore
+func SafeGroupName(name string) string {
+  return unsafe_group_chars_re.ReplaceAllString(name, "_")
+}
+
+func sortedStringKeys(m map[string]string) []string {
+  keys := make([]string, 0, len(m))
+  for k, _ := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
@@ -0,0 +1,182 @@
+package inventory
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+)
+
+type Group struct {
+  Name string
+  Vars map[string]interface{}
+  // the distance from the "all" group, used (along with the priority)
+  // to decide which group variables win when a host is in many groups
+  Depth int
+  Priority int
+
+  ChildGroups []*Group
+  ParentGroups []*Group
+  // the hosts which are direct members of this group
+  Hosts []*Host
+
+  // variables from the group_vars/ directories next to the
+  // inventory sources and next to the playbook
+  inventory_dir_vars map[string]interface{}
+  playbook_dir_vars map[string]interface{}
+}
+
+func (g *Group) AddChildGroup(child *Group) error {
+  if g == child {
+    return fmt.Errorf("Cannot add group '%s' as a child of itself", g.Name)
+  }
+  for _, ancestor := range g.GetAncestors() {
+    if ancestor == child {
+      return fmt.Errorf("Adding group '%s' as child to '%s' creates a recursive dependency loop", child.Name, g.Name)
+    }
+  }
+  for _, existing := range g.ChildGroups {
+    if existing == child {
+      return nil
+    }
+  }
+  g.ChildGroups = append(g.ChildGroups, child)
+  child.ParentGroups = append(child.ParentGroups, g)
+  child.updateDepth(g.Depth + 1)
+  return nil
+}
+
+// pushes the new depth down the tree, since the children of a group
+// must always be deeper than their deepest parent
+func (g *Group) updateDepth(depth int) {
+  if depth <= g.Depth {
+    return
+  }
+  g.Depth = depth
+  for _, child := range g.ChildGroups {
+    child.updateDepth(depth + 1)
+  }
+}
+
+// all of the groups above this one in the tree, nearest first
+func (g *Group) GetAncestors() []*Group {
+  ancestors := make([]*Group, 0)
+  seen := make(map[*Group]bool)
+  pending := append([]*Group{}, g.ParentGroups...)
+  for len(pending) > 0 {
+    parent := pending[0]
+    pending = pending[1:]
+    if seen[parent] {
+      continue
+    }
+    seen[parent] = true
+    ancestors = append(ancestors, parent)
+    pending = append(pending, parent.ParentGroups...)
+  }
+  return ancestors
+}
+
+// all of the groups below this one in the tree, nearest first
+func (g *Group) GetDescendants() []*Group {
+  descendants := make([]*Group, 0)
+  seen := make(map[*Group]bool)
+  pending := append([]*Group{}, g.ChildGroups...)
+  for len(pending) > 0 {
+    child := pending[0]
+    pending = pending[1:]
+    if seen[child] {
+      continue
+    }
+    seen[child] = true
+    descendants = append(descendants, child)
+    pending = append(pending, child.ChildGroups...)
+  }
+  return descendants
+}
+
+func (g *Group) AddHost(host *Host) {
+  for _, existing := range g.Hosts {
+    if existing == host {
+      return
+    }
+  }
+  g.Hosts = append(g.Hosts, host)
+  host.addGroup(g)
+}
+
+func (g *Group) RemoveHost(host *Host) {
+  for i, existing := range g.Hosts {
+    if existing == host {
+      g.Hosts = append(g.Hosts[:i], g.Hosts[i+1:]...)
+      host.removeGroup(g)
+      return
+    }
+  }
+}
+
+// returns the hosts in this group and in all of its descendants
+func (g *Group) GetHosts() []*Host {
+  hosts := make([]*Host, 0)
+  seen := make(map[*Host]bool)
+  for _, group := range append([]*Group{g}, g.GetDescendants()...) {
+    for _, host := range group.Hosts {
+      if !seen[host] {
+        seen[host] = true
+        hosts = append(hosts, host)
+      }
+    }
+  }
+  return hosts
+}
+
+func (g *Group) SetVariable(key string, value interface{}) {
+  if key == "ansible_group_priority" {
+    switch v := value.(type) {
+    case int:
+      g.Priority = v
+    case string:
+      if p, err := strconv.Atoi(v); err == nil {
+        g.Priority = p
+      }
+    }
+  }
+  g.Vars[key] = value
+}
+
+func (g *Group) GetVars() map[string]interface{} {
+  vars := make(map[string]interface{})
+  for k, v := range g.Vars {
+    vars[k] = v
+  }
+  return vars
+}
+
+// SortGroups orders groups the way their variables are applied: by
+// depth, then priority and finally by name, so later groups win
+func SortGroups(groups []*Group) []*Group {
+  sorted := make([]*Group, len(groups))
+  copy(sorted, groups)
+  sort.SliceStable(sorted, func(i, j int) bool {
+    if sorted[i].Depth != sorted[j].Depth {
+      return sorted[i].Depth < sorted[j].Depth
+    }
+    if sorted[i].Priority != sorted[j].Priority {
+      return sorted[i].Priority < sorted[j].Priority
+    }
+    return sorted[i].Name < sorted[j].Name
+  })
+  return sorted
+}
+
+func NewGroup(name string) *Group {
+  g := new(Group)
+  g.Name = name
+  g.Vars = make(map[string]interface{})
+  g.Depth = 0
+  g.Priority = 1
+  g.ChildGroups = make([]*Group, 0)
+  g.ParentGroups = make([]*Group, 0)
+  g.Hosts = make([]*Host, 0)
+  g.inventory_dir_vars = make(map[string]interface{})
+  g.playbook_dir_vars = make(map[string]interface{})
+  return g
+}
@@ -1,10 +1,135 @@
 package inventory
 
-import ()
+import (
+  "sort"
+  "strings"
+)
 
 type Host struct {
   Name string
   Vars map[string]interface{}
+  // set for hosts which were not in the inventory sources,
+  // such as the implicit localhost
+  Implicit bool
+  // the groups this host is a direct member of, the groups
+  // above them in the tree are found through Groups()
+  groups []*Group
+  // variables from the host_vars/ directories next to the
+  // inventory sources and next to the playbook
+  inventory_dir_vars map[string]interface{}
+  playbook_dir_vars map[string]interface{}
+}
+
+func (h *Host) addGroup(group *Group) {
+  for _, existing := range h.groups {
+    if existing == group {
+      return
+    }
+  }
+  h.groups = append(h.groups, group)
+}
+
+func (h *Host) removeGroup(group *Group) {
+  for i, existing := range h.groups {
+    if existing == group {
+      h.groups = append(h.groups[:i], h.groups[i+1:]...)
+      return
+    }
+  }
+}
+
+// returns every group the host belongs to, including the
+// ancestors of the groups it was directly added to
+func (h *Host) Groups() []*Group {
+  groups := make([]*Group, 0)
+  seen := make(map[*Group]bool)
+  for _, group := range h.groups {
+    for _, g := range append([]*Group{group}, group.GetAncestors()...) {
+      if !seen[g] {
+        seen[g] = true
+        groups = append(groups, g)
+      }
+    }
+  }
+  return groups
+}
+
+func (h *Host) GroupNames() []string {
+  names := make([]string, 0)
+  for _, group := range h.Groups() {
+    if group.Name != "all" {
+      names = append(names, group.Name)
+    }
+  }
+  sort.Strings(names)
+  return names
+}
+
+func (h *Host) SetVariable(key string, value interface{}) {
+  h.Vars[key] = value
+}
+
+// the variables from all of the host's groups, in order of precedence
+// (lowest first):
+//
+//   1. group vars from the inventory sources
+//   2. inventory group_vars/all
+//   3. playbook group_vars/all
+//   4. inventory group_vars/*
+//   5. playbook group_vars/*
+//
+// Within each step the groups are merged in SortGroups() order, so
+// deeper and higher priority groups win.
+func (h *Host) GetGroupVars() map[string]interface{} {
+  vars := make(map[string]interface{})
+  groups := SortGroups(h.Groups())
+  for _, group := range groups {
+    mergeVars(vars, group.GetVars())
+  }
+  for _, group := range groups {
+    if group.Name == "all" {
+      mergeVars(vars, group.inventory_dir_vars)
+      mergeVars(vars, group.playbook_dir_vars)
+    }
+  }
+  for _, group := range groups {
+    if group.Name != "all" {
+      mergeVars(vars, group.inventory_dir_vars)
+    }
+  }
+  for _, group := range groups {
+    if group.Name != "all" {
+      mergeVars(vars, group.playbook_dir_vars)
+    }
+  }
+  return vars
+}
+
+// the variables set for the host itself, from the inventory sources
+// and then the inventory and playbook host_vars/ directories
+func (h *Host) GetHostVars() map[string]interface{} {
+  vars := make(map[string]interface{})
+  mergeVars(vars, h.Vars)
+  mergeVars(vars, h.inventory_dir_vars)
+  mergeVars(vars, h.playbook_dir_vars)
+  return vars
+}
+
+func (h *Host) GetMagicVars() map[string]interface{} {
+  return map[string]interface{} {
+    "inventory_hostname": h.Name,
+    "inventory_hostname_short": strings.SplitN(h.Name, ".", 2)[0],
+    "group_names": h.GroupNames(),
+  }
+}
+
+// returns the group variables, overridden by the host variables
+// and then the magic variables for the host
+func (h *Host) GetVars() map[string]interface{} {
+  vars := h.GetGroupVars()
+  mergeVars(vars, h.GetHostVars())
+  mergeVars(vars, h.GetMagicVars())
+  return vars
 }
 
 func NewHost(name string, vars map[string]interface{}) *Host {
@@ -15,5 +140,9 @@ func NewHost(name string, vars map[string]interface{}) *Host {
   } else {
     h.Vars = make(map[string]interface{})
   }
+  h.Implicit = false
+  h.groups = make([]*Group, 0)
+  h.inventory_dir_vars = make(map[string]interface{})
+  h.playbook_dir_vars = make(map[string]interface{})
   return h
 }
@@ -0,0 +1,195 @@
+package inventory
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+var ini_section_re = regexp.MustCompile(`^\[([^:\]\s]+)(?::(\w+))?\]\s*(?:[#;].*)?$`)
+var ini_float_re = regexp.MustCompile(`^[-+]?[0-9]*\.[0-9]+([eE][-+]?[0-9]+)?$`)
+
+// ParseIniFile loads an INI style inventory file into the given inventory.
+// The layout is the same as the python version:
+//
+//   host1 ansible_port=2222
+//   [webservers]
+//   web1 http_port=8080
+//   web[02:10].example.com:2222
+//   [webservers:vars]
+//   ntp_server=ntp.example.com
+//   [production:children]
+//   webservers
+//
+// Hosts listed before the first section go into the "ungrouped" group.
+func ParseIniFile(path string, im *InventoryManager) error {
+  f, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  // groups referenced in :vars sections which have not (yet) been
+  // defined anywhere else, these must be defined by the end of the file
+  pending_groups := make(map[string]int)
+
+  group_name := "ungrouped"
+  state := "hosts"
+  lineno := 0
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    lineno += 1
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || line[0] == '#' || line[0] == ';' {
+      continue
+    }
+
+    if m := ini_section_re.FindStringSubmatch(line); m != nil {
+      group_name = m[1]
+      state = m[2]
+      if state == "" {
+        state = "hosts"
+      }
+      switch state {
+      case "hosts", "children":
+        delete(pending_groups, group_name)
+        im.AddGroup(group_name)
+      case "vars":
+        if !im.HasGroup(group_name) {
+          pending_groups[group_name] = lineno
+          im.AddGroup(group_name)
+        }
+      default:
+        return fmt.Errorf("%s:%d: Section [%s:%s] has unknown type: %s", path, lineno, group_name, state, state)
+      }
+      continue
+    } else if line[0] == '[' && line[len(line)-1] == ']' {
+      return fmt.Errorf("%s:%d: Invalid section entry: '%s'", path, lineno, line)
+    }
+
+    switch state {
+    case "hosts":
+      tokens, err := SplitIniLine(line)
+      if err != nil {
+        return fmt.Errorf("%s:%d: %s", path, lineno, err)
+      }
+      if len(tokens) == 0 {
+        continue
+      }
+      hosts, err := im.AddHostPattern(tokens[0], group_name)
+      if err != nil {
+        return fmt.Errorf("%s:%d: %s", path, lineno, err)
+      }
+      for _, token := range tokens[1:] {
+        k, v, ok := parseIniVariable(token)
+        if !ok {
+          return fmt.Errorf("%s:%d: Expected key=value host variable assignment, got: %s", path, lineno, token)
+        }
+        for _, host := range hosts {
+          host.SetVariable(k, v)
+        }
+      }
+    case "children":
+      child := strings.Fields(line)[0]
+      if err := im.AddChildGroup(group_name, child); err != nil {
+        return fmt.Errorf("%s:%d: %s", path, lineno, err)
+      }
+      delete(pending_groups, child)
+    case "vars":
+      k, v, ok := parseIniVariable(line)
+      if !ok {
+        return fmt.Errorf("%s:%d: Expected key=value, got: %s", path, lineno, line)
+      }
+      im.SetGroupVariable(group_name, k, v)
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return err
+  }
+
+  for name, at_line := range pending_groups {
+    if name != "all" && name != "ungrouped" {
+      return fmt.Errorf("%s:%d: Section [%s:vars] not valid for undefined group: %s", path, at_line, name, name)
+    }
+  }
+  return nil
+}
+
+// splits a host line into whitespace separated tokens, keeping quoted
+// strings together and dropping any trailing comment
+func SplitIniLine(line string) ([]string, error) {
+  tokens := make([]string, 0)
+  var cur strings.Builder
+  var quote_char rune = 0
+  in_token := false
+  for _, c := range line {
+    switch {
+    case quote_char != 0:
+      if c == quote_char {
+        quote_char = 0
+      }
+      cur.WriteRune(c)
+    case c == '"' || c == '\'':
+      quote_char = c
+      in_token = true
+      cur.WriteRune(c)
+    case c == '#' && !in_token:
+      if cur.Len() > 0 {
+        tokens = append(tokens, cur.String())
+      }
+      return tokens, nil
+    case c == ' ' || c == '\t':
+      if in_token {
+        tokens = append(tokens, cur.String())
+        cur.Reset()
+        in_token = false
+      }
+    default:
+      in_token = true
+      cur.WriteRune(c)
+    }
+  }
+  if quote_char != 0 {
+    return nil, fmt.Errorf("No closing quotation in line: %s", line)
+  }
+  if in_token {
+    tokens = append(tokens, cur.String())
+  }
+  return tokens, nil
+}
+
+func parseIniVariable(token string) (string, interface{}, bool) {
+  pos := strings.Index(token, "=")
+  if pos <= 0 {
+    return "", nil, false
+  }
+  k := strings.TrimSpace(token[:pos])
+  v := strings.TrimSpace(token[pos+1:])
+  return k, ParseIniValue(v), true
+}
+
+// converts a raw value into an int, float or bool when it looks like
+// one of those, otherwise it is returned as an (unquoted) string
+func ParseIniValue(value string) interface{} {
+  if i, err := strconv.Atoi(value); err == nil {
+    return i
+  }
+  if ini_float_re.MatchString(value) {
+    if f, err := strconv.ParseFloat(value, 64); err == nil {
+      return f
+    }
+  }
+  switch value {
+  case "True":
+    return true
+  case "False":
+    return false
+  }
+  if len(value) > 1 && value[0] == value[len(value)-1] && (value[0] == '"' || value[0] == '\'') {
+    return value[1:len(value)-1]
+  }
+  return value
+}
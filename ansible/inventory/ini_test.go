@@ -0,0 +1,247 @@
+package inventory
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+// writes the inventory source into a new temporary directory
+// and loads an inventory from it
+func loadTestInventory(t *testing.T, name string, data string) (*InventoryManager, error) {
+  path := filepath.Join(t.TempDir(), name)
+  if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+    t.Fatal(err)
+  }
+  return NewInventoryManager([]string{path}, nil)
+}
+
+// checks the error returned when loading an inventory, which should
+// contain want_err when it is set and otherwise be nil
+func checkInventoryError(t *testing.T, err error, want_err string) bool {
+  if want_err == "" {
+    if err != nil {
+      t.Errorf("unexpected error: %s", err)
+    }
+    return err == nil
+  }
+  if err == nil {
+    t.Errorf("expected an error containing %q", want_err)
+  } else if !strings.Contains(err.Error(), want_err) {
+    t.Errorf("expected an error containing %q, got: %s", want_err, err)
+  }
+  return false
+}
+
+type inventoryTest struct {
+  name string
+  data string
+  // the groups each host is in (as returned by GroupNames)
+  hosts map[string][]string
+  host_vars map[string]map[string]interface{}
+  group_vars map[string]map[string]interface{}
+  children map[string][]string
+  err string
+}
+
+func checkInventory(t *testing.T, im *InventoryManager, test inventoryTest) {
+  if test.hosts != nil {
+    hosts := make(map[string][]string)
+    for name, host := range im.Hosts {
+      hosts[name] = host.GroupNames()
+    }
+    if !reflect.DeepEqual(hosts, test.hosts) {
+      t.Errorf("hosts: got %v, want %v", hosts, test.hosts)
+    }
+  }
+  for name, want := range test.host_vars {
+    host := im.GetHost(name)
+    if host == nil {
+      t.Errorf("host %s was not loaded", name)
+    } else if !reflect.DeepEqual(host.Vars, want) {
+      t.Errorf("vars of host %s: got %#v, want %#v", name, host.Vars, want)
+    }
+  }
+  for name, want := range test.group_vars {
+    group := im.GetGroup(name)
+    if group == nil {
+      t.Errorf("group %s was not loaded", name)
+    } else if !reflect.DeepEqual(group.Vars, want) {
+      t.Errorf("vars of group %s: got %#v, want %#v", name, group.Vars, want)
+    }
+  }
+  for name, want := range test.children {
+    group := im.GetGroup(name)
+    if group == nil {
+      t.Errorf("group %s was not loaded", name)
+      continue
+    }
+    children := make([]string, 0)
+    for _, child := range group.ChildGroups {
+      children = append(children, child.Name)
+    }
+    if !reflect.DeepEqual(children, want) {
+      t.Errorf("children of group %s: got %v, want %v", name, children, want)
+    }
+  }
+}
+
+var ini_tests = []inventoryTest{
+  {
+    name: "ungrouped hosts",
+    data: "host1\nhost2 # a comment\n; another comment\n",
+    hosts: map[string][]string{"host1": {"ungrouped"}, "host2": {"ungrouped"}},
+  },
+  {
+    name: "host vars",
+    data: "host1 a=1 b=2.5 c=True d=False e=\"quoted string\" f=plain\n",
+    host_vars: map[string]map[string]interface{}{
+      "host1": {"a": 1, "b": 2.5, "c": true, "d": false, "e": "quoted string", "f": "plain"},
+    },
+  },
+  {
+    name: "groups and children",
+    data: `
+[web]
+web1
+web2
+
+[db]
+db1
+
+[prod:children]
+web
+db
+`,
+    hosts: map[string][]string{"web1": {"prod", "web"}, "web2": {"prod", "web"}, "db1": {"db", "prod"}},
+    children: map[string][]string{"prod": {"web", "db"}},
+  },
+  {
+    name: "group vars",
+    data: `
+[web]
+web1
+
+[web:vars]
+http_port=8080
+ntp_server = ntp.example.com
+
+[all:vars]
+x=1
+`,
+    group_vars: map[string]map[string]interface{}{
+      "web": {"http_port": 8080, "ntp_server": "ntp.example.com"},
+      "all": {"x": 1},
+    },
+  },
+  {
+    name: "vars before the group is defined",
+    data: "[web:vars]\na=1\n[web]\nweb1\n",
+    hosts: map[string][]string{"web1": {"web"}},
+    group_vars: map[string]map[string]interface{}{"web": {"a": 1}},
+  },
+  {
+    name: "host range with port",
+    data: "[web]\nweb[1:3].example.com:2222\n",
+    host_vars: map[string]map[string]interface{}{
+      "web1.example.com": {"ansible_host": "web1.example.com", "ansible_port": 2222},
+      "web2.example.com": {"ansible_host": "web2.example.com", "ansible_port": 2222},
+      "web3.example.com": {"ansible_host": "web3.example.com", "ansible_port": 2222},
+    },
+  },
+  {
+    name: "vars for an undefined group",
+    data: "[web:vars]\na=1\n",
+    err: "Section [web:vars] not valid for undefined group: web",
+  },
+  {
+    name: "unknown section type",
+    data: "[web:stuff]\n",
+    err: "Section [web:stuff] has unknown type: stuff",
+  },
+  {
+    name: "invalid section",
+    data: "[web two]\n",
+    err: "Invalid section entry: '[web two]'",
+  },
+  {
+    name: "bad host variable",
+    data: "host1 novalue\n",
+    err: "Expected key=value host variable assignment, got: novalue",
+  },
+  {
+    name: "bad group variable",
+    data: "[web]\nweb1\n[web:vars]\nnovalue\n",
+    err: "Expected key=value, got: novalue",
+  },
+  {
+    name: "unclosed quote",
+    data: "host1 a=\"oops\n",
+    err: "No closing quotation",
+  },
+  {
+    name: "child group loop",
+    data: "[a:children]\nb\n[b:children]\na\n",
+    err: "recursive dependency loop",
+  },
+}
+
+func TestParseIniFile(t *testing.T) {
+  for _, test := range ini_tests {
+    t.Run(test.name, func(t *testing.T) {
+      im, err := loadTestInventory(t, "hosts", test.data)
+      if checkInventoryError(t, err, test.err) {
+        checkInventory(t, im, test)
+      }
+    })
+  }
+}
+
+func TestSplitIniLine(t *testing.T) {
+  tests := []struct {
+    line string
+    want []string
+  }{
+    {"host1", []string{"host1"}},
+    {"host1  a=1\tb=2", []string{"host1", "a=1", "b=2"}},
+    {"host1 a=\"x y\" b='z # w'", []string{"host1", "a=\"x y\"", "b='z # w'"}},
+    {"host1 a=1 # comment", []string{"host1", "a=1"}},
+    {"host1 a=b#c", []string{"host1", "a=b#c"}},
+    {"# comment", []string{}},
+  }
+  for _, test := range tests {
+    got, err := SplitIniLine(test.line)
+    if err != nil {
+      t.Errorf("SplitIniLine(%q): unexpected error: %s", test.line, err)
+    } else if !reflect.DeepEqual(got, test.want) {
+      t.Errorf("SplitIniLine(%q) = %#v, want %#v", test.line, got, test.want)
+    }
+  }
+}
+
+func TestParseIniValue(t *testing.T) {
+  tests := []struct {
+    value string
+    want interface{}
+  }{
+    {"1", 1},
+    {"-12", -12},
+    {"1.5", 1.5},
+    {".5e3", 500.0},
+    {"True", true},
+    {"False", false},
+    {"true", "true"},
+    {"'quoted'", "quoted"},
+    {"\"quoted\"", "quoted"},
+    {"'", "'"},
+    {"1.2.3.4", "1.2.3.4"},
+    {"text", "text"},
+  }
+  for _, test := range tests {
+    if got := ParseIniValue(test.value); !reflect.DeepEqual(got, test.want) {
+      t.Errorf("ParseIniValue(%q) = %#v, want %#v", test.value, got, test.want)
+    }
+  }
+}
@@ -1,13 +1,396 @@
 package inventory
 
-import ()
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// file names and extensions we skip when a directory is given as
+// an inventory source, these are never inventory files themselves
+var IgnoredInventoryNames = []string{"host_vars", "group_vars"}
+var IgnoredInventoryExtensions = []string{"~", ".orig", ".bak", ".cfg", ".retry", ".pyc", ".pyo"}
 
 type InventoryManager struct {
+  Sources []string
+  Hosts map[string]*Host
+  Groups map[string]*Group
+
+  // hosts and groups in the order they were first seen in the
+  // sources, so that anything iterating over the inventory is stable
+  host_order []string
+  group_order []string
+  // the patterns given with --limit, which apply to every
+  // GetHosts() call for the rest of the run
+  subset []string
+  // when set, only these host names are returned by GetHosts()
+  restriction map[string]bool
+  // created on demand, see implicitLocalhost()
+  localhost *Host
+  // the constructed sources, applied after everything else is loaded
+  constructed []*ConstructedConfig
+  // the enabled inventory plugins, in the order they are tried
+  plugins []namedInventoryPlugin
+  // when set, the parsed sources are loaded from and saved to this cache
+  Cache *InventoryCache
+  // the playbook directory given to SetPlaybookDir, which is
+  // loaded again when the inventory is refreshed
+  playbook_dir string
+}
+
+func (im *InventoryManager) ParseSources() error {
+  // the host_vars/ and group_vars/ directories are not cached,
+  // so they are always loaded from disk. An invalid cache entry may
+  // be partly loaded before it is found, so it is loaded into a
+  // scratch inventory and only used if all of it was loaded.
+  if im.Cache != nil {
+    cached := im.scratch()
+    if im.Cache.Load(cached) {
+      if err := im.merge(cached); err != nil {
+        return err
+      }
+      im.reconcile()
+      return im.loadInventoryVarsDirs()
+    }
+  }
+
+  for _, source := range im.Sources {
+    if err := im.ParseSource(source); err != nil {
+      return err
+    }
+  }
+  im.reconcile()
+  if err := im.loadInventoryVarsDirs(); err != nil {
+    return err
+  }
+  if len(im.constructed) > 0 {
+    if err := im.ApplyConstructed(); err != nil {
+      return err
+    }
+    // the constructed groups may have their own group_vars
+    im.reconcile()
+    if err := im.loadInventoryVarsDirs(); err != nil {
+      return err
+    }
+  }
+
+  if im.Cache != nil {
+    if err := im.Cache.Save(im); err != nil {
+      fmt.Println("[WARNING]: Could not update the inventory cache:", err)
+    }
+  }
+  return nil
+}
+
+// Refresh throws away everything loaded from the sources and parses
+// them again, as the refresh_inventory meta task does. The cache is
+// not read, since the sources are expected to have changed.
+func (im *InventoryManager) Refresh() error {
+  im.clear()
+  cache := im.Cache
+  im.Cache = nil
+  err := im.ParseSources()
+  im.Cache = cache
+  if err != nil {
+    return err
+  }
+  if im.Cache != nil {
+    if err := im.Cache.Save(im); err != nil {
+      fmt.Println("[WARNING]: Could not update the inventory cache:", err)
+    }
+  }
+  if im.playbook_dir != "" {
+    return im.SetPlaybookDir(im.playbook_dir)
+  }
+  return nil
+}
+
+// removes everything loaded from the sources, leaving
+// only the implicit groups every inventory has
+func (im *InventoryManager) clear() {
+  im.Hosts = make(map[string]*Host)
+  im.Groups = make(map[string]*Group)
+  im.host_order = make([]string, 0)
+  im.group_order = make([]string, 0)
+  im.localhost = nil
+  im.constructed = make([]*ConstructedConfig, 0)
+  im.AddGroup("all")
+  im.AddChildGroup("all", "ungrouped")
+}
+
+// returns an empty inventory with the same sources and plugins, which a
+// source is loaded into first, so that one which fails partway through
+// leaves nothing behind in this inventory (see merge)
+func (im *InventoryManager) scratch() *InventoryManager {
+  scratch := new(InventoryManager)
+  scratch.Sources = im.Sources
+  scratch.plugins = im.plugins
+  scratch.clear()
+  // the existing groups are known, so a source may refer to a
+  // group defined by an earlier one, as in [group:vars]
+  for _, name := range im.group_order {
+    scratch.AddGroup(name)
+  }
+  return scratch
+}
+
+// adds everything loaded into the other inventory to this one, as if it
+// had been loaded here, later values replace those already set
+func (im *InventoryManager) merge(other *InventoryManager) error {
+  for _, name := range other.group_order {
+    group := im.AddGroup(name)
+    for k, v := range other.Groups[name].Vars {
+      group.SetVariable(k, v)
+    }
+  }
+  for _, name := range other.host_order {
+    host := im.AddHost(name, "")
+    for k, v := range other.Hosts[name].Vars {
+      host.SetVariable(k, v)
+    }
+  }
+  for _, name := range other.group_order {
+    for _, child := range other.Groups[name].ChildGroups {
+      if err := im.AddChildGroup(name, child.Name); err != nil {
+        return err
+      }
+    }
+    for _, host := range other.Groups[name].Hosts {
+      im.AddHost(host.Name, name)
+    }
+  }
+  im.constructed = append(im.constructed, other.constructed...)
+  return nil
+}
+
+// ParseSource loads one -i source, a directory loads every source in
+// it, otherwise each enabled inventory plugin is tried in turn
+func (im *InventoryManager) ParseSource(source string) error {
+  if info, err := os.Stat(source); err == nil && info.IsDir() {
+    entries, err := ioutil.ReadDir(source)
+    if err != nil {
+      return err
+    }
+    for _, entry := range entries {
+      if IgnoredInventorySource(entry.Name()) {
+        continue
+      }
+      if err := im.ParseSource(filepath.Join(source, entry.Name())); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+  return im.parseWithPlugins(source)
+}
+
+func IgnoredInventorySource(name string) bool {
+  if strings.HasPrefix(name, ".") {
+    return true
+  }
+  for _, ignored := range IgnoredInventoryNames {
+    if name == ignored {
+      return true
+    }
+  }
+  for _, ext := range IgnoredInventoryExtensions {
+    if strings.HasSuffix(name, ext) {
+      return true
+    }
+  }
+  return false
+}
+
+func (im *InventoryManager) AddGroup(name string) *Group {
+  group, ok := im.Groups[name]
+  if !ok {
+    group = NewGroup(name)
+    im.Groups[name] = group
+    im.group_order = append(im.group_order, name)
+  }
+  return group
+}
+
+func (im *InventoryManager) HasGroup(name string) bool {
+  _, ok := im.Groups[name]
+  return ok
+}
+
+func (im *InventoryManager) GetGroup(name string) *Group {
+  if group, ok := im.Groups[name]; ok {
+    return group
+  }
+  return nil
+}
+
+func (im *InventoryManager) AddChildGroup(group string, child string) error {
+  return im.AddGroup(group).AddChildGroup(im.AddGroup(child))
+}
+
+// adds the host to the inventory if it does not already exist,
+// and if a group name is given also makes it a member of that group
+func (im *InventoryManager) AddHost(name string, group string) *Host {
+  host, ok := im.Hosts[name]
+  if !ok {
+    host = NewHost(name, nil)
+    im.Hosts[name] = host
+    im.host_order = append(im.host_order, name)
+  }
+  if group != "" {
+    im.AddGroup(group).AddHost(host)
+  }
+  return host
+}
+
+func (im *InventoryManager) GetHost(name string) *Host {
+  if host, ok := im.Hosts[name]; ok {
+    return host
+  }
+  return nil
+}
+
+func (im *InventoryManager) SetGroupVariable(group string, key string, value interface{}) {
+  im.AddGroup(group).SetVariable(key, value)
+}
+
+func (im *InventoryManager) SetHostVariable(name string, key string, value interface{}) {
+  im.AddHost(name, "").SetVariable(key, value)
+}
+
+// the group names in the order they were added to the inventory
+func (im *InventoryManager) GroupNames() []string {
+  names := make([]string, len(im.group_order))
+  copy(names, im.group_order)
+  return names
+}
+
+// the "groups" magic variable, mapping every group name to the
+// names of the hosts in it (including those in child groups)
+func (im *InventoryManager) GetGroupsDict() map[string][]string {
+  groups := make(map[string][]string)
+  for _, name := range im.group_order {
+    group_hosts := make([]string, 0)
+    for _, host := range im.sortHosts(im.Groups[name].GetHosts()) {
+      group_hosts = append(group_hosts, host.Name)
+    }
+    groups[name] = group_hosts
+  }
+  return groups
+}
+
+func (im *InventoryManager) GetMagicVars() map[string]interface{} {
+  return map[string]interface{} {
+    "groups": im.GetGroupsDict(),
+  }
+}
+
+// returns the hosts matching the given host patterns (see
+// SplitHostPattern), honoring the subset given with --limit and
+// any restriction currently set on the inventory
+func (im *InventoryManager) GetHosts(patterns []string) []Host {
+  matched := im.evaluatePatterns(patterns)
+  var subset map[*Host]bool = nil
+  if im.subset != nil {
+    subset = hostSet(im.evaluatePatterns(im.subset))
+  }
+
+  hosts := make([]Host, 0)
+  for _, host := range matched {
+    if subset != nil && !subset[host] {
+      continue
+    }
+    if im.restriction != nil && !im.restriction[host.Name] {
+      continue
+    }
+    hosts = append(hosts, *host)
+  }
+  return hosts
+}
+
+func (im *InventoryManager) RestrictToHosts(hosts []Host) {
+  im.restriction = make(map[string]bool)
+  for _, host := range hosts {
+    im.restriction[host.Name] = true
+  }
+}
+
+func (im *InventoryManager) RemoveRestriction() {
+  im.restriction = nil
+}
 
+// returns the given hosts in inventory order, any hosts which are
+// not in the inventory (the implicit localhost) are kept at the end
+func (im *InventoryManager) sortHosts(hosts []*Host) []*Host {
+  wanted := make(map[string]bool)
+  for _, host := range hosts {
+    wanted[host.Name] = true
+  }
+  sorted := make([]*Host, 0, len(hosts))
+  for _, name := range im.host_order {
+    if wanted[name] {
+      sorted = append(sorted, im.Hosts[name])
+      delete(wanted, name)
+    }
+  }
+  for _, host := range hosts {
+    if wanted[host.Name] {
+      sorted = append(sorted, host)
+      delete(wanted, host.Name)
+    }
+  }
+  return sorted
+}
+
+// reconcile makes sure the group tree is complete once all of the
+// sources have been parsed: every top level group becomes a child of
+// "all", and hosts which are not in any group are put in "ungrouped"
+// (and taken out of it again if a later source gave them a group)
+func (im *InventoryManager) reconcile() {
+  all := im.AddGroup("all")
+  ungrouped := im.AddGroup("ungrouped")
+  for _, name := range im.group_order {
+    group := im.Groups[name]
+    if group != all && len(group.ParentGroups) == 0 {
+      all.AddChildGroup(group)
+    }
+  }
+  for _, name := range im.host_order {
+    host := im.Hosts[name]
+    grouped := false
+    for _, group := range host.groups {
+      if group != all && group != ungrouped {
+        grouped = true
+      }
+    }
+    if grouped {
+      ungrouped.RemoveHost(host)
+    } else {
+      ungrouped.AddHost(host)
+    }
+  }
+}
+
+func StringPos(value string, list []string) int {
+  for p, v := range list {
+    if v == value {
+      return p
+    }
+  }
+  return -1
 }
 
-func (im *InventoryManager) GetHosts() []Host {
-  return []Host{
-    *NewHost("192.168.122.100", nil),
+func NewInventoryManager(sources []string, cache *InventoryCache) (*InventoryManager, error) {
+  im := new(InventoryManager)
+  im.Sources = sources
+  im.Cache = cache
+  im.subset = nil
+  im.restriction = nil
+  im.clear()
+  im.loadPlugins()
+  if err := im.ParseSources(); err != nil {
+    return nil, err
   }
+  return im, nil
 }
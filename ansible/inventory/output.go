@@ -0,0 +1,128 @@
+package inventory
+
+import (
+  "fmt"
+  "strings"
+)
+
+// ListJSON returns the inventory in the dynamic inventory JSON format
+// (the same format read by ParseInventoryJSON). Normally the group vars
+// are merged into the _meta hostvars, but when export is set they are
+// kept with their groups and the hostvars only hold the host's own vars.
+// Only the hosts in the --limit subset are listed.
+func (im *InventoryManager) ListJSON(export bool) map[string]interface{} {
+  results := make(map[string]interface{})
+  seen := make(map[string]bool)
+  selected := im.selectedHosts()
+  im.listGroupJSON(im.Groups["all"], export, selected, results, seen)
+
+  hostvars := make(map[string]interface{})
+  for _, name := range im.host_order {
+    host := im.Hosts[name]
+    if !selected[name] {
+      continue
+    }
+    if export {
+      hostvars[name] = host.GetHostVars()
+    } else {
+      vars := host.GetGroupVars()
+      mergeVars(vars, host.GetHostVars())
+      hostvars[name] = vars
+    }
+  }
+  results["_meta"] = map[string]interface{}{"hostvars": hostvars}
+  return results
+}
+
+// the names of the hosts left by the --limit subset
+func (im *InventoryManager) selectedHosts() map[string]bool {
+  selected := make(map[string]bool)
+  for _, host := range im.GetHosts([]string{"all"}) {
+    selected[host.Name] = true
+  }
+  return selected
+}
+
+// the vars of the group, including those from the group_vars/ directories
+func exportGroupVars(group *Group) map[string]interface{} {
+  vars := group.GetVars()
+  mergeVars(vars, group.inventory_dir_vars)
+  mergeVars(vars, group.playbook_dir_vars)
+  return vars
+}
+
+func (im *InventoryManager) listGroupJSON(group *Group, export bool, selected map[string]bool, results map[string]interface{}, seen map[string]bool) {
+  seen[group.Name] = true
+  group_data := make(map[string]interface{})
+
+  // every host is somewhere below "all", so it never lists hosts itself
+  if group.Name != "all" {
+    hosts := make([]string, 0)
+    for _, host := range group.Hosts {
+      if selected[host.Name] {
+        hosts = append(hosts, host.Name)
+      }
+    }
+    if len(hosts) > 0 {
+      group_data["hosts"] = hosts
+    }
+  }
+  if len(group.ChildGroups) > 0 {
+    children := make([]string, 0)
+    for _, child := range group.ChildGroups {
+      children = append(children, child.Name)
+    }
+    group_data["children"] = children
+  }
+  if export {
+    if vars := exportGroupVars(group); len(vars) > 0 {
+      group_data["vars"] = vars
+    }
+  }
+  if len(group_data) > 0 || group.Name == "all" {
+    results[group.Name] = group_data
+  }
+
+  for _, child := range group.ChildGroups {
+    if !seen[child.Name] {
+      im.listGroupJSON(child, export, selected, results, seen)
+    }
+  }
+}
+
+// Graph draws the group tree below the named group, with the hosts
+// of each group in the --limit subset listed after its child groups:
+//
+//   @all:
+//     |--@ungrouped:
+//     |--@webservers:
+//     |  |--web1
+func (im *InventoryManager) Graph(name string) ([]string, error) {
+  group, ok := im.Groups[name]
+  if !ok {
+    return nil, fmt.Errorf("Pattern must be a valid group name when using --graph: %s", name)
+  }
+  return graphGroup(group, im.selectedHosts(), 0), nil
+}
+
+func graphName(name string, depth int) string {
+  if depth > 0 {
+    return strings.Repeat("  |", depth) + "--" + name
+  }
+  return name
+}
+
+func graphGroup(group *Group, selected map[string]bool, depth int) []string {
+  lines := []string{graphName("@" + group.Name + ":", depth)}
+  for _, child := range group.ChildGroups {
+    lines = append(lines, graphGroup(child, selected, depth + 1)...)
+  }
+  if group.Name != "all" {
+    for _, host := range group.Hosts {
+      if selected[host.Name] {
+        lines = append(lines, graphName(host.Name, depth + 1))
+      }
+    }
+  }
+  return lines
+}
@@ -0,0 +1,325 @@
+package inventory
+
+import (
+  "bufio"
+  "fmt"
+  "net"
+  "os"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// host names which are matched by the implicit localhost, when
+// the inventory does not already contain a host by that name
+var LocalhostNames = []string{"localhost", "127.0.0.1", "::1"}
+
+var pattern_split_re = regexp.MustCompile(`(?:[^\s:\[\]]|\[[^\]]*\])+`)
+var pattern_subscript_re = regexp.MustCompile(`^(.+)\[(?:(-?[0-9]+)|([0-9]+)([:-])([0-9]*))\]$`)
+
+type patternSubscript struct {
+  start int
+  end int
+  is_range bool
+}
+
+// SplitHostPattern splits a pattern such as "web:&prod:!canary" or
+// "web,db" into its parts. Colons inside an IPv6 address or inside of a
+// [subscript] are not treated as separators.
+func SplitHostPattern(pattern string) []string {
+  patterns := make([]string, 0)
+  if strings.Contains(pattern, ",") {
+    for _, p := range strings.Split(pattern, ",") {
+      patterns = append(patterns, SplitHostPattern(p)...)
+    }
+    return patterns
+  }
+  pattern = strings.TrimSpace(pattern)
+  if pattern == "" {
+    return patterns
+  }
+  if ip := net.ParseIP(pattern); ip != nil || pattern[0] == '~' {
+    return append(patterns, pattern)
+  }
+  for _, p := range pattern_split_re.FindAllString(pattern, -1) {
+    patterns = append(patterns, strings.TrimSpace(p))
+  }
+  return patterns
+}
+
+// OrderPatterns puts the plain patterns first, followed by the
+// intersections (&) and then the exclusions (!). If there are no plain
+// patterns at all, "all" is used as the starting point.
+func OrderPatterns(patterns []string) []string {
+  regular := make([]string, 0)
+  intersection := make([]string, 0)
+  exclude := make([]string, 0)
+  for _, p := range patterns {
+    if p == "" {
+      continue
+    } else if p == "!" || p == "&" {
+      // an operator without a pattern to apply it to, as in "web:!"
+      fmt.Println("[WARNING]: Invalid host pattern:", p)
+      continue
+    } else if p[0] == '!' {
+      exclude = append(exclude, p)
+    } else if p[0] == '&' {
+      intersection = append(intersection, p)
+    } else {
+      regular = append(regular, p)
+    }
+  }
+  if len(regular) == 0 {
+    regular = append(regular, "all")
+  }
+  ordered := append(regular, intersection...)
+  return append(ordered, exclude...)
+}
+
+// evaluates a list of host patterns, each of which may itself be a
+// compound pattern, returning the matching hosts without duplicates
+func (im *InventoryManager) evaluatePatterns(pattern_list []string) []*Host {
+  patterns := make([]string, 0)
+  for _, p := range pattern_list {
+    patterns = append(patterns, SplitHostPattern(p)...)
+  }
+
+  hosts := make([]*Host, 0)
+  for _, p := range OrderPatterns(patterns) {
+    switch p[0] {
+    case '!':
+      that := hostSet(im.matchOnePattern(p[1:]))
+      filtered := make([]*Host, 0)
+      for _, h := range hosts {
+        if !that[h] {
+          filtered = append(filtered, h)
+        }
+      }
+      hosts = filtered
+    case '&':
+      that := hostSet(im.matchOnePattern(p[1:]))
+      filtered := make([]*Host, 0)
+      for _, h := range hosts {
+        if that[h] {
+          filtered = append(filtered, h)
+        }
+      }
+      hosts = filtered
+    default:
+      existing := hostSet(hosts)
+      for _, h := range im.matchOnePattern(p) {
+        if !existing[h] {
+          hosts = append(hosts, h)
+          existing[h] = true
+        }
+      }
+    }
+  }
+  return hosts
+}
+
+// matches a single pattern (which may have a subscript) against the
+// group names, and then against the host names if no group matched or
+// the pattern may match more than one name (a glob or a regex, or a
+// name containing a dot, which may be a host name or an address)
+func (im *InventoryManager) matchOnePattern(pattern string) []*Host {
+  expr, subscript, err := splitSubscript(pattern)
+  if err != nil {
+    fmt.Println("[WARNING]:", err)
+    return nil
+  }
+
+  matched := make([]*Host, 0)
+  for _, name := range im.group_order {
+    if matchPattern(name, expr) {
+      matched = append(matched, im.Groups[name].GetHosts()...)
+    }
+  }
+  if len(matched) == 0 || expr[0] == '~' || strings.ContainsAny(expr, ".?*[") {
+    for _, name := range im.host_order {
+      if matchPattern(name, expr) {
+        matched = append(matched, im.Hosts[name])
+      }
+    }
+  }
+  if len(matched) == 0 && StringPos(expr, LocalhostNames) != -1 {
+    matched = append(matched, im.implicitLocalhost(expr))
+  }
+  if len(matched) == 0 {
+    return matched
+  }
+
+  return applySubscript(im.sortHosts(matched), subscript)
+}
+
+func splitSubscript(pattern string) (string, *patternSubscript, error) {
+  // regular expressions may legitimately end in a bracket expression
+  if pattern == "" || pattern[0] == '~' {
+    return pattern, nil, nil
+  }
+  m := pattern_subscript_re.FindStringSubmatch(pattern)
+  if m == nil {
+    return pattern, nil, nil
+  }
+  subscript := new(patternSubscript)
+  if m[2] != "" {
+    subscript.start, _ = strconv.Atoi(m[2])
+  } else {
+    subscript.is_range = true
+    subscript.start, _ = strconv.Atoi(m[3])
+    if m[4] == "-" {
+      fmt.Println("[WARNING]: Use [x:y] inclusive subscripts instead of [x-y] which has been removed")
+    }
+    if m[5] == "" {
+      subscript.end = -1
+    } else {
+      subscript.end, _ = strconv.Atoi(m[5])
+      if subscript.end < subscript.start {
+        return "", nil, fmt.Errorf("Invalid subscript in host pattern '%s'", pattern)
+      }
+    }
+  }
+  return m[1], subscript, nil
+}
+
+// subscripts are inclusive, so web[0:2] is the first three hosts
+func applySubscript(hosts []*Host, subscript *patternSubscript) []*Host {
+  if subscript == nil {
+    return hosts
+  }
+  if !subscript.is_range {
+    idx := subscript.start
+    if idx < 0 {
+      idx += len(hosts)
+    }
+    if idx < 0 || idx >= len(hosts) {
+      return []*Host{}
+    }
+    return []*Host{hosts[idx]}
+  }
+  start := subscript.start
+  end := subscript.end
+  if end == -1 || end >= len(hosts) {
+    end = len(hosts) - 1
+  }
+  if start > end {
+    return []*Host{}
+  }
+  return hosts[start:end+1]
+}
+
+// patterns starting with ~ are regular expressions, those containing
+// any of the shell glob characters are globs and anything else must
+// match exactly
+func matchPattern(name string, pattern string) bool {
+  if pattern == "" {
+    return false
+  }
+  if pattern[0] == '~' {
+    re, err := regexp.Compile(pattern[1:])
+    if err != nil {
+      fmt.Println("[WARNING]: Invalid host pattern:", pattern)
+      return false
+    }
+    loc := re.FindStringIndex(name)
+    return loc != nil && loc[0] == 0
+  }
+  if strings.ContainsAny(pattern, "*?[") {
+    return globToRegexp(pattern).MatchString(name)
+  }
+  return name == pattern
+}
+
+func globToRegexp(pattern string) *regexp.Regexp {
+  var expr strings.Builder
+  expr.WriteString("^")
+  in_class := false
+  skip := false
+  for i, c := range pattern {
+    switch {
+    case skip:
+      skip = false
+    case in_class:
+      if c == ']' {
+        in_class = false
+      }
+      if c == '\\' {
+        expr.WriteString(`\\`)
+      } else {
+        expr.WriteRune(c)
+      }
+    case c == '*':
+      expr.WriteString(".*")
+    case c == '?':
+      expr.WriteString(".")
+    case c == '[':
+      in_class = true
+      expr.WriteRune(c)
+      // fnmatch uses [!...] for a negated class
+      if strings.HasPrefix(pattern[i+1:], "!") {
+        expr.WriteRune('^')
+        skip = true
+      }
+    default:
+      expr.WriteString(regexp.QuoteMeta(string(c)))
+    }
+  }
+  expr.WriteString("$")
+  re, err := regexp.Compile(expr.String())
+  if err != nil {
+    return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+  }
+  return re
+}
+
+func hostSet(hosts []*Host) map[*Host]bool {
+  set := make(map[*Host]bool)
+  for _, h := range hosts {
+    set[h] = true
+  }
+  return set
+}
+
+// the implicit localhost is used when a play targets localhost but the
+// inventory does not list it, it is not a member of any group
+func (im *InventoryManager) implicitLocalhost(name string) *Host {
+  if im.localhost == nil {
+    im.localhost = NewHost(name, nil)
+    im.localhost.Implicit = true
+    im.localhost.SetVariable("ansible_connection", "local")
+  }
+  return im.localhost
+}
+
+// Subset limits every later GetHosts() call to the hosts matching the
+// given pattern (the --limit option). A pattern starting with @ names a
+// file containing one host name per line.
+func (im *InventoryManager) Subset(subset_pattern string) error {
+  if subset_pattern == "" {
+    im.subset = nil
+    return nil
+  }
+  patterns := make([]string, 0)
+  for _, p := range SplitHostPattern(subset_pattern) {
+    if p[0] != '@' {
+      patterns = append(patterns, p)
+      continue
+    }
+    f, err := os.Open(p[1:])
+    if err != nil {
+      return fmt.Errorf("Unable to read the limit file %s: %s", p[1:], err)
+    }
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+      if line := strings.TrimSpace(scanner.Text()); line != "" {
+        patterns = append(patterns, line)
+      }
+    }
+    f.Close()
+    if err := scanner.Err(); err != nil {
+      return err
+    }
+  }
+  im.subset = patterns
+  return nil
+}
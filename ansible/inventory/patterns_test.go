@@ -0,0 +1,126 @@
+package inventory
+
+import (
+  "reflect"
+  "testing"
+)
+
+const patterns_inventory = `
+webmail
+
+[web]
+web1
+web2
+web3
+
+[db]
+db1
+db2
+
+[canary]
+web3
+
+[prod:children]
+web
+db
+`
+
+func hostNames(hosts []*Host) []string {
+  names := make([]string, 0)
+  for _, host := range hosts {
+    names = append(names, host.Name)
+  }
+  return names
+}
+
+func TestSplitHostPattern(t *testing.T) {
+  tests := []struct {
+    pattern string
+    want []string
+  }{
+    {"web", []string{"web"}},
+    {"web:&prod:!canary", []string{"web", "&prod", "!canary"}},
+    {"web,db", []string{"web", "db"}},
+    {" web , db:db1 ", []string{"web", "db", "db1"}},
+    {"web[0:2]:db", []string{"web[0:2]", "db"}},
+    {"fe80::1", []string{"fe80::1"}},
+    {"~web[0-9]:db", []string{"~web[0-9]:db"}},
+    {"", []string{}},
+  }
+  for _, test := range tests {
+    if got := SplitHostPattern(test.pattern); !reflect.DeepEqual(got, test.want) {
+      t.Errorf("SplitHostPattern(%q) = %#v, want %#v", test.pattern, got, test.want)
+    }
+  }
+}
+
+func TestMatchOnePattern(t *testing.T) {
+  im, err := loadTestInventory(t, "hosts", patterns_inventory)
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    pattern string
+    want []string
+  }{
+    {"web", []string{"web1", "web2", "web3"}},
+    {"db1", []string{"db1"}},
+    {"all", []string{"webmail", "web1", "web2", "web3", "db1", "db2"}},
+    {"ungrouped", []string{"webmail"}},
+    {"nosuch", []string{}},
+    {"", []string{}},
+    // globs and regular expressions match both the groups and the hosts
+    {"web*", []string{"webmail", "web1", "web2", "web3"}},
+    {"db?", []string{"db1", "db2"}},
+    {"web[!1]*", []string{"webmail", "web2", "web3"}},
+    {"~web", []string{"webmail", "web1", "web2", "web3"}},
+    {"~db[0-9]", []string{"db1", "db2"}},
+    {"~mail", []string{}},
+    // subscripts are inclusive
+    {"web[0]", []string{"web1"}},
+    {"web[-1]", []string{"web3"}},
+    {"web[1:]", []string{"web2", "web3"}},
+    {"web[0:1]", []string{"web1", "web2"}},
+    {"web[5]", []string{}},
+    {"web[2:1]", []string{}},
+    // the implicit localhost, when it is not in the inventory
+    {"localhost", []string{"localhost"}},
+  }
+  for _, test := range tests {
+    if got := hostNames(im.matchOnePattern(test.pattern)); !reflect.DeepEqual(got, test.want) {
+      t.Errorf("matchOnePattern(%q) = %v, want %v", test.pattern, got, test.want)
+    }
+  }
+}
+
+func TestEvaluatePatterns(t *testing.T) {
+  im, err := loadTestInventory(t, "hosts", patterns_inventory)
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    patterns []string
+    want []string
+  }{
+    {[]string{"web,db"}, []string{"web1", "web2", "web3", "db1", "db2"}},
+    {[]string{"web", "db1"}, []string{"web1", "web2", "web3", "db1"}},
+    {[]string{"web:web1"}, []string{"web1", "web2", "web3"}},
+    {[]string{"prod:&web"}, []string{"web1", "web2", "web3"}},
+    {[]string{"prod:!canary"}, []string{"web1", "web2", "db1", "db2"}},
+    {[]string{"!canary:prod"}, []string{"web1", "web2", "db1", "db2"}},
+    {[]string{"&db"}, []string{"db1", "db2"}},
+    {[]string{"!prod"}, []string{"webmail"}},
+    {[]string{"web[0]:db[-1]"}, []string{"web1", "db2"}},
+    {[]string{"web*:!web"}, []string{"webmail"}},
+    {[]string{"nosuch"}, []string{}},
+    // operators without a pattern are ignored
+    {[]string{"web:!"}, []string{"web1", "web2", "web3"}},
+    {[]string{"web,&"}, []string{"web1", "web2", "web3"}},
+    {[]string{"web", "!"}, []string{"web1", "web2", "web3"}},
+  }
+  for _, test := range tests {
+    if got := hostNames(im.evaluatePatterns(test.patterns)); !reflect.DeepEqual(got, test.want) {
+      t.Errorf("evaluatePatterns(%q) = %v, want %v", test.patterns, got, test.want)
+    }
+  }
+}
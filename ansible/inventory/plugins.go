@@ -0,0 +1,133 @@
+package inventory
+
+import (
+  "fmt"
+  "os"
+  "strings"
+)
+
+// InventoryPlugin is the contract for inventory sources. Verify is a quick
+// check of whether the source looks like something the plugin can handle,
+// and Parse then loads it into the inventory.
+type InventoryPlugin interface {
+  Verify(path string) bool
+  Parse(path string, im *InventoryManager) error
+}
+
+// the plugins tried when ANSIBLE_INVENTORY_ENABLED is not set, in order
+var DefaultInventoryPlugins = []string{"host_list", "script", "terraform", "ssh_config", "yaml", "ini"}
+
+// LoadExternalInventoryPlugin is used for any enabled plugin which is not
+// built in, it is set by the caller since the plugin loader depends on this
+// package. It returns nil when no plugin by that name exists.
+var LoadExternalInventoryPlugin func(name string) InventoryPlugin
+
+// the plugins for the sources which are always available
+type builtinInventoryPlugin struct {
+  verify func(path string) bool
+  parse func(path string, im *InventoryManager) error
+}
+
+func (p *builtinInventoryPlugin) Verify(path string) bool {
+  return p.verify(path)
+}
+
+func (p *builtinInventoryPlugin) Parse(path string, im *InventoryManager) error {
+  return p.parse(path, im)
+}
+
+var builtin_inventory_plugins = map[string]InventoryPlugin {
+  "script": &builtinInventoryPlugin{
+    verify: func(path string) bool {
+      info, err := os.Stat(path)
+      return err == nil && IsInventoryScript(info)
+    },
+    parse: ParseInventoryScript,
+  },
+  "yaml": &builtinInventoryPlugin{
+    verify: func(path string) bool {
+      return isInventoryFile(path) && IsYamlInventory(path)
+    },
+    parse: ParseYamlFile,
+  },
+  "ini": &builtinInventoryPlugin{
+    verify: isInventoryFile,
+    parse: ParseIniFile,
+  },
+}
+
+func isInventoryFile(path string) bool {
+  info, err := os.Stat(path)
+  return err == nil && info.Mode().IsRegular()
+}
+
+type namedInventoryPlugin struct {
+  name string
+  plugin InventoryPlugin
+}
+
+// EnabledInventoryPlugins returns the names of the plugins to try on each
+// source, from the comma separated ANSIBLE_INVENTORY_ENABLED if it is set
+func EnabledInventoryPlugins() []string {
+  enabled := os.Getenv("ANSIBLE_INVENTORY_ENABLED")
+  if enabled == "" {
+    return DefaultInventoryPlugins
+  }
+  names := make([]string, 0)
+  for _, name := range strings.Split(enabled, ",") {
+    if name = strings.TrimSpace(name); name != "" {
+      names = append(names, name)
+    }
+  }
+  return names
+}
+
+// finds the enabled plugins, built in plugins are used before
+// any external plugin with the same name
+func (im *InventoryManager) loadPlugins() {
+  configured := os.Getenv("ANSIBLE_INVENTORY_ENABLED") != ""
+  im.plugins = make([]namedInventoryPlugin, 0)
+  for _, name := range EnabledInventoryPlugins() {
+    plugin, ok := builtin_inventory_plugins[name]
+    if !ok && LoadExternalInventoryPlugin != nil {
+      plugin = LoadExternalInventoryPlugin(name)
+    }
+    if plugin == nil {
+      // the default list includes plugins which may not have been built
+      if configured {
+        fmt.Printf("[WARNING]: Failed to load inventory plugin, skipping %s\n", name)
+      }
+      continue
+    }
+    im.plugins = append(im.plugins, namedInventoryPlugin{name, plugin})
+  }
+}
+
+// tries each of the enabled plugins on the source, stopping at the first
+// one which parses it. A source no plugin will accept is only a warning,
+// but if every plugin which accepted it failed that is an error. Each
+// plugin parses into a scratch inventory, so that anything a failed
+// plugin loaded is not seen by the next one.
+func (im *InventoryManager) parseWithPlugins(source string) error {
+  var last_err error
+  failures := make([]string, 0)
+  for _, p := range im.plugins {
+    if !p.plugin.Verify(source) {
+      continue
+    }
+    scratch := im.scratch()
+    if err := p.plugin.Parse(source, scratch); err != nil {
+      last_err = err
+      failures = append(failures, fmt.Sprintf("%s: %s", p.name, err))
+      continue
+    }
+    return im.merge(scratch)
+  }
+  if len(failures) == 1 {
+    return last_err
+  } else if len(failures) > 0 {
+    return fmt.Errorf("Unable to parse %s as an inventory source:\n  %s", source, strings.Join(failures, "\n  "))
+  }
+  fmt.Println("[WARNING]: Unable to parse", source, "as an inventory source")
+  return nil
+}
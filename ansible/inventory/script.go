@@ -0,0 +1,174 @@
+package inventory
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "os"
+  "os/exec"
+  "strings"
+)
+
+// any regular file with an execute bit set is treated as a dynamic
+// inventory script rather than being parsed as INI or YAML
+func IsInventoryScript(info os.FileInfo) bool {
+  return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// runs the inventory script with the given arguments, returning the
+// decoded JSON it printed on stdout
+func runInventoryScript(path string, args ...string) (map[string]interface{}, error) {
+  cmd := exec.Command(path, args...)
+  var stdout, stderr bytes.Buffer
+  cmd.Stdout = &stdout
+  cmd.Stderr = &stderr
+  if err := cmd.Run(); err != nil {
+    msg := strings.TrimSpace(stderr.String())
+    if msg == "" {
+      msg = err.Error()
+    }
+    return nil, fmt.Errorf("Inventory script (%s %s) had an execution error: %s", path, strings.Join(args, " "), msg)
+  }
+
+  decoder := json.NewDecoder(&stdout)
+  decoder.UseNumber()
+  var data interface{}
+  if err := decoder.Decode(&data); err != nil {
+    return nil, fmt.Errorf("Inventory script (%s %s) returned invalid JSON: %s", path, strings.Join(args, " "), err)
+  }
+  res, ok := NormalizeValue(data).(map[string]interface{})
+  if !ok {
+    return nil, fmt.Errorf("Inventory script (%s %s) did not return a JSON dictionary", path, strings.Join(args, " "))
+  }
+  return res, nil
+}
+
+// ParseInventoryScript runs an executable inventory source with --list,
+// which must print a JSON dictionary of groups in the format:
+//
+//   {
+//     "webservers": {"hosts": ["web1"], "vars": {...}, "children": [...]},
+//     "databases": ["db1", "db2"],
+//     "_meta": {"hostvars": {"web1": {...}}}
+//   }
+//
+// When there is no _meta.hostvars the script is run again with
+// --host <name> for every host to get its variables.
+func ParseInventoryScript(path string, im *InventoryManager) error {
+  data, err := runInventoryScript(path, "--list")
+  if err != nil {
+    return err
+  }
+  return ParseInventoryJSON(data, im, func(host string) (map[string]interface{}, error) {
+    return runInventoryScript(path, "--host", host)
+  })
+}
+
+// ParseInventoryJSON loads the dynamic inventory JSON format into the
+// inventory. When the data has no _meta.hostvars, get_host_vars is
+// called for each host instead (if it is not nil).
+func ParseInventoryJSON(data map[string]interface{}, im *InventoryManager, get_host_vars func(string) (map[string]interface{}, error)) error {
+  var meta_hostvars map[string]interface{} = nil
+  hosts := make([]string, 0)
+  for _, group := range sortedKeys(data) {
+    if group == "_meta" {
+      if meta, ok := data[group].(map[string]interface{}); ok {
+        if hostvars, ok := meta["hostvars"].(map[string]interface{}); ok {
+          meta_hostvars = hostvars
+        }
+      }
+      continue
+    }
+    group_hosts, err := parseJSONGroup(im, group, data[group])
+    if err != nil {
+      return err
+    }
+    for _, host := range group_hosts {
+      if StringPos(host, hosts) == -1 {
+        hosts = append(hosts, host)
+      }
+    }
+  }
+
+  for _, host := range hosts {
+    var host_vars map[string]interface{} = nil
+    if meta_hostvars != nil {
+      if v, ok := meta_hostvars[host]; ok {
+        if host_vars, ok = v.(map[string]interface{}); !ok {
+          return fmt.Errorf("Invalid host variables for %s, expected a dictionary", host)
+        }
+      }
+    } else if get_host_vars != nil {
+      res, err := get_host_vars(host)
+      if err != nil {
+        return err
+      }
+      host_vars = res
+    }
+    for k, v := range host_vars {
+      im.SetHostVariable(host, k, v)
+    }
+  }
+  return nil
+}
+
+// a group is normally a dictionary with hosts, vars and children, but
+// may also be a plain list of hosts. A dictionary with none of those
+// keys is the legacy format for a single host with its variables.
+func parseJSONGroup(im *InventoryManager, group string, group_data interface{}) ([]string, error) {
+  im.AddGroup(group)
+  data, ok := group_data.(map[string]interface{})
+  if !ok {
+    data = map[string]interface{}{"hosts": group_data}
+  } else {
+    _, has_hosts := data["hosts"]
+    _, has_vars := data["vars"]
+    _, has_children := data["children"]
+    if !has_hosts && !has_vars && !has_children {
+      data = map[string]interface{}{"hosts": []interface{}{group}, "vars": data}
+    }
+  }
+
+  hosts := make([]string, 0)
+  if data["hosts"] != nil {
+    host_list, ok := data["hosts"].([]interface{})
+    if !ok {
+      return nil, fmt.Errorf("You defined a group '%s' with bad data for the host list: %v", group, data["hosts"])
+    }
+    for _, h := range host_list {
+      name, ok := h.(string)
+      if !ok {
+        return nil, fmt.Errorf("Invalid host name in group '%s': %v", group, h)
+      }
+      im.AddHost(name, group)
+      hosts = append(hosts, name)
+    }
+  }
+
+  if data["vars"] != nil {
+    vars, ok := data["vars"].(map[string]interface{})
+    if !ok {
+      return nil, fmt.Errorf("You defined a group '%s' with bad data for variables: %v", group, data["vars"])
+    }
+    for k, v := range vars {
+      im.SetGroupVariable(group, k, v)
+    }
+  }
+
+  if data["children"] != nil {
+    children, ok := data["children"].([]interface{})
+    if !ok {
+      return nil, fmt.Errorf("You defined a group '%s' with bad data for the children: %v", group, data["children"])
+    }
+    for _, c := range children {
+      child, ok := c.(string)
+      if !ok {
+        return nil, fmt.Errorf("Invalid child group name in group '%s': %v", group, c)
+      }
+      if err := im.AddChildGroup(group, child); err != nil {
+        return nil, err
+      }
+    }
+  }
+  return hosts, nil
+}
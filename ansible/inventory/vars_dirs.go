@@ -0,0 +1,187 @@
+package inventory
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "github.com/smallfish/simpleyaml"
+)
+
+// the extensions allowed for files in host_vars/ and group_vars/,
+// files with no extension at all are also loaded
+var VarsFileExtensions = []string{".yml", ".yaml", ".json"}
+
+// LoadEntityVars loads the variables for one host or group from the
+// host_vars/ or group_vars/ directory (subdir) under basedir. The vars
+// may be in a single file named after the entity (with or without a YAML
+// extension), or in a directory of that name, in which case every file
+// in it is loaded in sorted order.
+func LoadEntityVars(basedir string, subdir string, name string) (map[string]interface{}, error) {
+  vars := make(map[string]interface{})
+  base := filepath.Join(basedir, subdir, name)
+
+  found := make([]string, 0)
+  for _, ext := range append([]string{""}, VarsFileExtensions...) {
+    info, err := os.Stat(base + ext)
+    if err != nil {
+      continue
+    }
+    if info.IsDir() {
+      if ext == "" {
+        files, err := findVarsFiles(base)
+        if err != nil {
+          return nil, err
+        }
+        found = append(found, files...)
+      }
+    } else {
+      found = append(found, base + ext)
+    }
+  }
+
+  for _, path := range found {
+    file_vars, err := LoadVarsFile(path)
+    if err != nil {
+      return nil, err
+    }
+    for k, v := range file_vars {
+      vars[k] = v
+    }
+  }
+  return vars, nil
+}
+
+func findVarsFiles(dir string) ([]string, error) {
+  entries, err := ioutil.ReadDir(dir)
+  if err != nil {
+    return nil, err
+  }
+  names := make([]string, 0)
+  for _, entry := range entries {
+    names = append(names, entry.Name())
+  }
+  sort.Strings(names)
+
+  files := make([]string, 0)
+  for _, name := range names {
+    path := filepath.Join(dir, name)
+    if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+      continue
+    }
+    if info, err := os.Stat(path); err == nil && info.IsDir() {
+      sub_files, err := findVarsFiles(path)
+      if err != nil {
+        return nil, err
+      }
+      files = append(files, sub_files...)
+    } else if ext := filepath.Ext(name); ext == "" || StringPos(ext, VarsFileExtensions) != -1 {
+      files = append(files, path)
+    }
+  }
+  return files, nil
+}
+
+// LoadVarsFile loads a YAML (or JSON) file which must contain a dictionary
+func LoadVarsFile(path string) (map[string]interface{}, error) {
+  data, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  yaml_data, err := simpleyaml.NewYaml(data)
+  if err != nil {
+    return nil, fmt.Errorf("%s: Invalid YAML: %s", path, err)
+  }
+  if !yaml_data.IsFound() {
+    return make(map[string]interface{}), nil
+  }
+  vars_map, err := yaml_data.Map()
+  if err != nil {
+    return nil, fmt.Errorf("%s: vars files must contain a dictionary of variables", path)
+  }
+  return NormalizeValue(vars_map).(map[string]interface{}), nil
+}
+
+// loads the host_vars/ and group_vars/ found in basedir for every host and
+// group in the inventory, returning them keyed by the host or group name
+func (im *InventoryManager) loadVarsDir(basedir string) (map[string]map[string]interface{}, map[string]map[string]interface{}, error) {
+  group_vars := make(map[string]map[string]interface{})
+  host_vars := make(map[string]map[string]interface{})
+  for _, name := range im.group_order {
+    vars, err := LoadEntityVars(basedir, "group_vars", name)
+    if err != nil {
+      return nil, nil, err
+    }
+    group_vars[name] = vars
+  }
+  for _, name := range im.host_order {
+    vars, err := LoadEntityVars(basedir, "host_vars", name)
+    if err != nil {
+      return nil, nil, err
+    }
+    host_vars[name] = vars
+  }
+  return group_vars, host_vars, nil
+}
+
+// loads the host_vars/ and group_vars/ next to each of the inventory
+// sources, where a directory source is its own base directory
+func (im *InventoryManager) loadInventoryVarsDirs() error {
+  for _, group := range im.Groups {
+    group.inventory_dir_vars = make(map[string]interface{})
+  }
+  for _, host := range im.Hosts {
+    host.inventory_dir_vars = make(map[string]interface{})
+  }
+  seen := make(map[string]bool)
+  for _, source := range im.Sources {
+    info, err := os.Stat(source)
+    if err != nil {
+      continue
+    }
+    basedir := source
+    if !info.IsDir() {
+      basedir = filepath.Dir(source)
+    }
+    if seen[basedir] {
+      continue
+    }
+    seen[basedir] = true
+    group_vars, host_vars, err := im.loadVarsDir(basedir)
+    if err != nil {
+      return err
+    }
+    for name, vars := range group_vars {
+      mergeVars(im.Groups[name].inventory_dir_vars, vars)
+    }
+    for name, vars := range host_vars {
+      mergeVars(im.Hosts[name].inventory_dir_vars, vars)
+    }
+  }
+  return nil
+}
+
+// SetPlaybookDir loads the host_vars/ and group_vars/ next to the
+// playbook being run, replacing those of any previous playbook
+func (im *InventoryManager) SetPlaybookDir(basedir string) error {
+  group_vars, host_vars, err := im.loadVarsDir(basedir)
+  if err != nil {
+    return err
+  }
+  im.playbook_dir = basedir
+  for name, group := range im.Groups {
+    group.playbook_dir_vars = group_vars[name]
+  }
+  for name, host := range im.Hosts {
+    host.playbook_dir_vars = host_vars[name]
+  }
+  return nil
+}
+
+func mergeVars(dest map[string]interface{}, src map[string]interface{}) {
+  for k, v := range src {
+    dest[k] = v
+  }
+}
@@ -0,0 +1,186 @@
+package inventory
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "path/filepath"
+  "sort"
+  "github.com/smallfish/simpleyaml"
+)
+
+var YamlInventoryExtensions = []string{".yaml", ".yml", ".json"}
+
+func IsYamlInventory(path string) bool {
+  return StringPos(filepath.Ext(path), YamlInventoryExtensions) != -1
+}
+
+// ParseYamlFile loads a YAML inventory, where each top level key is a
+// group which may in turn contain hosts, vars and child groups:
+//
+//   all:
+//     hosts:
+//       host1:
+//     vars:
+//       ntp_server: ntp.example.com
+//     children:
+//       webservers:
+//         hosts:
+//           web1:
+//             http_port: 8080
+//
+// A host may be listed under any number of groups, the host variables
+// from every entry are merged together. YAML mappings have no order, so
+// groups and hosts are added in sorted order to keep the inventory stable.
+func ParseYamlFile(path string, im *InventoryManager) error {
+  yaml_file, err := ioutil.ReadFile(path)
+  if err != nil {
+    return err
+  }
+  inventory_data, err := simpleyaml.NewYaml(yaml_file)
+  if err != nil {
+    return fmt.Errorf("%s: Invalid YAML: %s", path, err)
+  }
+  if !inventory_data.IsFound() {
+    // an empty file is a valid (if empty) inventory
+    return nil
+  }
+  data, err := inventory_data.Map()
+  if err != nil {
+    return fmt.Errorf("%s: YAML inventory has invalid structure, it should be a dictionary of groups", path)
+  }
+  if IsConstructedConfig(data) {
+    return ParseConstructedConfig(path, data, im)
+  }
+  groups, _ := yamlSection(data)
+  for _, name := range sortedKeys(groups) {
+    if err := parseYamlGroup(path, im, name, groups[name]); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func parseYamlGroup(path string, im *InventoryManager, group string, group_data interface{}) error {
+  im.AddGroup(group)
+  if group_data == nil {
+    return nil
+  }
+  data, ok := group_data.(map[interface{}]interface{})
+  if !ok {
+    return fmt.Errorf("%s: Invalid data for group %s, expected a dictionary of hosts, vars and children", path, group)
+  }
+
+  for k, _ := range data {
+    if key, _ := k.(string); key != "vars" && key != "children" && key != "hosts" {
+      fmt.Printf("[WARNING]: Skipping unexpected key (%v) in group (%s), only \"vars\", \"children\" and \"hosts\" are valid\n", k, group)
+    }
+  }
+
+  if vars, err := yamlSection(data["vars"]); err != nil {
+    return fmt.Errorf("%s: Invalid vars for group %s: %s", path, group, err)
+  } else {
+    for k, v := range vars {
+      im.SetGroupVariable(group, k, NormalizeValue(v))
+    }
+  }
+
+  if children, err := yamlSection(data["children"]); err != nil {
+    return fmt.Errorf("%s: Invalid children for group %s: %s", path, group, err)
+  } else {
+    for _, child := range sortedKeys(children) {
+      if err := parseYamlGroup(path, im, child, children[child]); err != nil {
+        return err
+      }
+      if err := im.AddChildGroup(group, child); err != nil {
+        return fmt.Errorf("%s: %s", path, err)
+      }
+    }
+  }
+
+  if hosts, err := yamlSection(data["hosts"]); err != nil {
+    return fmt.Errorf("%s: Invalid hosts for group %s: %s", path, group, err)
+  } else {
+    for _, pattern := range sortedKeys(hosts) {
+      group_hosts, err := im.AddHostPattern(pattern, group)
+      if err != nil {
+        return fmt.Errorf("%s: %s", path, err)
+      }
+      host_vars, err := yamlSection(hosts[pattern])
+      if err != nil {
+        return fmt.Errorf("%s: Invalid vars for host %s: %s", path, pattern, err)
+      }
+      for _, host := range group_hosts {
+        for k, v := range host_vars {
+          host.SetVariable(k, NormalizeValue(v))
+        }
+      }
+    }
+  }
+  return nil
+}
+
+// a section (vars, children or hosts) is normally a dictionary, but
+// may also be given as a single name or omitted entirely
+func yamlSection(section interface{}) (map[string]interface{}, error) {
+  res := make(map[string]interface{})
+  switch s := section.(type) {
+  case nil:
+  case string:
+    res[s] = nil
+  case map[interface{}]interface{}:
+    for k, v := range s {
+      key, ok := k.(string)
+      if !ok {
+        key = fmt.Sprintf("%v", k)
+      }
+      res[key] = v
+    }
+  default:
+    return nil, fmt.Errorf("expected a dictionary, got %v", section)
+  }
+  return res, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+  keys := make([]string, 0, len(m))
+  for k, _ := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// converts the map[interface{}]interface{} values produced by the YAML
+// parser (recursively) into map[string]interface{}, which is what the
+// rest of the inventory (and JSON encoding) expects. JSON numbers are
+// turned into an int when possible, otherwise a float64.
+func NormalizeValue(value interface{}) interface{} {
+  switch v := value.(type) {
+  case json.Number:
+    if i, err := v.Int64(); err == nil {
+      return int(i)
+    }
+    f, _ := v.Float64()
+    return f
+  case map[interface{}]interface{}:
+    res := make(map[string]interface{})
+    for k, item := range v {
+      res[fmt.Sprintf("%v", k)] = NormalizeValue(item)
+    }
+    return res
+  case map[string]interface{}:
+    res := make(map[string]interface{})
+    for k, item := range v {
+      res[k] = NormalizeValue(item)
+    }
+    return res
+  case []interface{}:
+    res := make([]interface{}, len(v))
+    for i, item := range v {
+      res[i] = NormalizeValue(item)
+    }
+    return res
+  }
+  return value
+}
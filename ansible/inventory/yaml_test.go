@@ -0,0 +1,131 @@
+package inventory
+
+import (
+  "testing"
+)
+
+var yaml_tests = []inventoryTest{
+  {
+    name: "empty file",
+    data: "",
+    hosts: map[string][]string{},
+  },
+  {
+    name: "nested groups",
+    data: `
+all:
+  hosts:
+    host1:
+  children:
+    prod:
+      children:
+        web:
+          hosts:
+            web1:
+            web2:
+        db:
+          hosts:
+            db1:
+`,
+    hosts: map[string][]string{
+      "host1": {"ungrouped"},
+      "web1": {"prod", "web"},
+      "web2": {"prod", "web"},
+      "db1": {"db", "prod"},
+    },
+    children: map[string][]string{"all": {"ungrouped", "prod"}, "prod": {"db", "web"}},
+  },
+  {
+    name: "vars",
+    data: `
+web:
+  vars:
+    http_port: 8080
+    servers: [a, b]
+    opts: {x: 1}
+  hosts:
+    web1:
+      a: 1
+      b: [1, 2]
+      c: {d: e}
+`,
+    host_vars: map[string]map[string]interface{}{
+      "web1": {"a": 1, "b": []interface{}{1, 2}, "c": map[string]interface{}{"d": "e"}},
+    },
+    group_vars: map[string]map[string]interface{}{
+      "web": {"http_port": 8080, "servers": []interface{}{"a", "b"}, "opts": map[string]interface{}{"x": 1}},
+    },
+  },
+  {
+    name: "host in many groups merges vars",
+    data: `
+web:
+  hosts:
+    host1:
+      a: 1
+db:
+  hosts:
+    host1:
+      b: 2
+`,
+    hosts: map[string][]string{"host1": {"db", "web"}},
+    host_vars: map[string]map[string]interface{}{"host1": {"a": 1, "b": 2}},
+  },
+  {
+    name: "host range",
+    data: `
+web:
+  hosts:
+    web[1:2]:
+      a: 1
+`,
+    hosts: map[string][]string{"web1": {"web"}, "web2": {"web"}},
+    host_vars: map[string]map[string]interface{}{"web1": {"a": 1}, "web2": {"a": 1}},
+  },
+  {
+    name: "single name sections",
+    data: `
+prod:
+  children: web
+web:
+  hosts: web1
+`,
+    hosts: map[string][]string{"web1": {"prod", "web"}},
+  },
+  {
+    name: "not a dictionary",
+    data: "- web1\n- web2\n",
+    err: "YAML inventory has invalid structure",
+  },
+  {
+    name: "invalid group",
+    data: "web: [web1]\n",
+    err: "Invalid data for group web",
+  },
+  {
+    name: "invalid vars",
+    data: "web:\n  vars: [a]\n",
+    err: "Invalid vars for group web",
+  },
+  {
+    name: "invalid host vars",
+    data: "web:\n  hosts:\n    web1: [a]\n",
+    err: "Invalid vars for host web1",
+  },
+  {
+    name: "invalid yaml",
+    data: "web: [\n",
+    err: "Invalid YAML",
+  },
+}
+
+func TestParseYamlFile(t *testing.T) {
+  for _, test := range yaml_tests {
+    t.Run(test.name, func(t *testing.T) {
+      im, err := loadTestInventory(t, "hosts.yml", test.data)
+      if checkInventoryError(t, err, test.err) {
+        checkInventory(t, im, test)
+      }
+    })
+  }
+}
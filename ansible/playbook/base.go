@@ -6,6 +6,7 @@ import (
   "reflect"
   "strconv"
   "strings"
+  "../inventory"
 )
 
 type FieldAttribute struct {
@@ -100,26 +101,29 @@ func LoadValidFields(thing interface{}, field_map map[string]FieldAttribute, dat
             }
           }
         case "string":
-          if str_value, ok := field_data.(string); ok {
-            field_data = make([]string, 1)
-            field_data.([]string)[0] = str_value
-          } else {
-            if list_data, ok := field_data.([]interface{}); ok {
-              new_list := make([]string, len(field_data.([]interface{})))
-              for i, d := range list_data {
-                new_list[i] = d.(string)
-              }
-              field_data = new_list
-            } else {
-              fmt.Println("Could not turn the list", field_name, " into a list of interfaces")
+          // scalars such as "when: true" are loaded as their string
+          // form, which is how they will be evaluated anyway
+          switch list_data := field_data.(type) {
+          case []interface{}:
+            new_list := make([]string, len(list_data))
+            for i, d := range list_data {
+              new_list[i] = fmt.Sprint(d)
             }
+            field_data = new_list
+          case string, bool, int, float64:
+            field_data = []string{fmt.Sprint(list_data)}
+          default:
+            fmt.Println("Could not turn the list", field_name, " into a list of interfaces")
           }
         }
       }
       field.Set(reflect.ValueOf(field_data))
       delete(data, k)
     } else {
-      if v.Default != nil {
+      // inherited fields are left unset, so that GetInheritedValue can tell
+      // they were not given and take the parent value instead, their
+      // getters fall back to the default
+      if v.Default != nil && !v.Inherit {
         field.Set(reflect.ValueOf(v.Default))
       } else {
         field.Set(reflect.Zero(field.Type()))
@@ -136,6 +140,8 @@ func ValidateFields(thing Validateable, data map[interface{}]interface{}, is_tas
       if _, found = all_fields[ks]; !found {
         if is_task {
           _, found = ModuleCache[ks]
+          // with_<lookup> loops
+          found = found || strings.HasPrefix(ks, "with_")
         }
       }
       if !found {
@@ -157,7 +163,7 @@ func PostValidate(thing Validateable) Validateable {
 // The base struct and related methods/etc.
 
 var base_fields = map[string]FieldAttribute{
-  "name": FieldAttribute{T: "string", Default: "", Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,},
+  "name": FieldAttribute{T: "string", Default: "", Required: false, Priority: 0, Inherit: false, Alias: []string{}, Extend: false, Prepend: false,},
   "connection": FieldAttribute{T: "string", Default: "smart", Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,},
   "port": FieldAttribute{T: "int", Default: 22, Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,},
   "remote_user": FieldAttribute{T: "string", Default: "", Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,},
@@ -213,6 +219,14 @@ func (b *Base) Connection() string {
     return res
   }
 }
+func (b *Base) IgnoreErrors() bool {
+  if res, ok := b.GetInheritedValue("ignore_errors").(bool); ok {
+    return res
+  } else {
+    res, _ := base_fields["ignore_errors"].Default.(bool)
+    return res
+  }
+}
 func (b *Base) Port() int {
   if res, ok := b.GetInheritedValue("port").(int); ok {
     return res
@@ -222,6 +236,14 @@ func (b *Base) Port() int {
   }
 }
 
+// the vars set directly on this object, which are never inherited
+func (b *Base) Vars() map[string]interface{} {
+  if res, ok := inventory.NormalizeValue(b.Attr_vars).(map[string]interface{}); ok {
+    return res
+  }
+  return make(map[string]interface{})
+}
+
 func (b *Base) Load(data map[interface{}]interface{}) {
   b.squashed = false
   b.finalized = false
@@ -60,15 +60,16 @@ func (b *Block) GetInheritedValue(attr string) interface{} {
     cur_value = nil
   }
 
-  get_parent_value := field_attribute.Inherit &&
-                      cur_value != reflect.Zero(field.Type()) &&
-                      !(b.squashed || b.finalized)
+  if b.squashed || b.finalized {
+    return cur_value
+  }
+  get_parent_value := field_attribute.Inherit && cur_value == nil
   if get_parent_value || field_attribute.Extend {
     if b.parent != nil {
       parent_value := b.parent.GetInheritedValue(attr)
-      if parent_value != reflect.Zero(field.Type()) && parent_value != nil {
+      if parent_value != nil {
         if field_attribute.Extend && cur_value != nil {
-          cur_value = ExtendValue(cur_value.([]interface{}), parent_value.([]interface{}), field_attribute.Prepend)
+          cur_value = ExtendValue(cur_value, parent_value, field_attribute.Prepend)
         } else {
           cur_value = parent_value
         }
@@ -178,6 +179,22 @@ func (b *Block) FilterTaggedTasks(play_context *PlayContext) *Block {
   return tag_evaluate_block(b, play_context)
 }
 
+// GetTasks returns all of the tasks in the block, including
+// those in any nested blocks, in the order they are defined
+func (b *Block) GetTasks() []Task {
+  task_list := make([]Task, 0)
+  for _, target := range [][]interface{}{b.Attr_block, b.Attr_rescue, b.Attr_always} {
+    for _, thing := range target {
+      if block, ok := thing.(Block); ok {
+        task_list = append(task_list, block.GetTasks()...)
+      } else if task, ok := thing.(Task); ok {
+        task_list = append(task_list, task)
+      }
+    }
+  }
+  return task_list
+}
+
 func (b *Block) HasTasks() bool {
   return len(b.Attr_block) > 0 || len(b.Attr_rescue) > 0 || len(b.Attr_always) > 0
 }
@@ -200,6 +217,23 @@ func (b *Block) DelegateFacts() bool {
   }
 }
 
+// GetVars returns the vars of this block, merged over those of
+// any parent blocks. The play vars are not included here, as
+// they have a lower precedence than other vars (see VariableManager).
+func (b *Block) GetVars() map[string]interface{} {
+  all_vars := make(map[string]interface{})
+  switch parent := b.parent.(type) {
+  case *Block:
+    all_vars = parent.GetVars()
+  case *Task:
+    all_vars = parent.GetVars()
+  }
+  for k, v := range b.Vars() {
+    all_vars[k] = v
+  }
+  return all_vars
+}
+
 func NewBlock(data map[interface{}]interface{}, play *Play, parent Parent, use_handlers bool) *Block {
   _, contains_block := data["block"]
   _, contains_rescue := data["rescue"]
@@ -2,11 +2,13 @@ package playbook
 
 import (
   "errors"
+  "fmt"
+  "strings"
   "github.com/jimi-c/jinja2"
 )
 
 type ConditionalEvaluate interface {
-  EvaluateConditional() bool
+  EvaluateConditional(templar *Templar) (bool, string, error)
   When() []string
 }
 
@@ -35,29 +37,64 @@ func (c *Conditional) When() []string {
   }
 }
 
-func EvaluateConditional(thing ConditionalEvaluate) (bool, error) {
-  context := jinja2.NewContext(nil)
-  context.AddVariables(map[string]interface{} {
-      "foo": true,
-    },
-  )
-  template := new(jinja2.Template)
-  for _, cond := range thing.When() {
-    err := template.Parse(`{% if ` + cond + ` %}True{% else %}False{% endif %}`)
+// EvaluateConditional evaluates every when clause (including those
+// inherited from the parent blocks) with the templar's variables, all of
+// which must be true. If one is false it is returned with the result.
+// The clauses may use any of the filters and tests, such as
+// "result is succeeded" with a registered result.
+func EvaluateConditional(thing ConditionalEvaluate, templar *Templar) (bool, string, error) {
+  return EvaluateConditionals(thing.When(), templar)
+}
+
+// EvaluateConditionals evaluates a list of conditions, such as a task's
+// changed_when or failed_when, in the same way as the when clauses
+func EvaluateConditionals(conditionals []string, templar *Templar) (bool, string, error) {
+  for _, cond := range conditionals {
+    res, err := evaluateClause(cond, templar)
     if err != nil {
-      return false, err
+      return false, cond, fmt.Errorf("The conditional check '%s' failed. The error was: %s", cond, err)
+    }
+    if !res {
+      return false, cond, nil
+    }
+  }
+  return true, "", nil
+}
+
+// EvaluateExpression evaluates a single condition with the given
+// variables, for the groups of the constructed inventory sources
+func EvaluateExpression(expr string, vars map[string]interface{}) (bool, error) {
+  return evaluateClause(expr, NewTemplar(vars))
+}
+
+func evaluateClause(cond string, templar *Templar) (bool, error) {
+  cond = strings.TrimSpace(cond)
+  if cond == "" {
+    return true, nil
+  }
+  if m := single_expression_re.FindStringSubmatch(cond); m != nil && !strings.Contains(m[1], "{{") {
+    fmt.Println("[WARNING]: conditional statements should not include jinja2 templating delimiters such as {{ }} or {% %}. Found:", cond)
+    cond = m[1]
+  }
+  if templar.Strict {
+    if name := templar.findUndefined("{{ " + cond + " }}"); name != "" {
+      return false, &UndefinedVariableError{name}
     }
-    if res, err := template.Render(context); err != nil {
-      return false, err
+  }
+  template := new(jinja2.Template)
+  err := template.Parse(`{% if ` + cond + ` %}True{% else %}False{% endif %}`)
+  if err != nil {
+    return false, err
+  }
+  if res, err := template.Render(templar.newContext()); err != nil {
+    return false, err
+  } else {
+    if res == "True" {
+      return true, nil
+    } else if res == "False" {
+      return false, nil
     } else {
-      if res == "True" {
-        return true, nil
-      } else if res == "False" {
-        return false, nil
-      } else {
-        return false, errors.New("Unknown result returned from conditional statement evaluation.")
-      }
+      return false, errors.New("Unknown result returned from conditional statement evaluation.")
     }
   }
-  return true, nil
 }
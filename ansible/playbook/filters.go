@@ -0,0 +1,776 @@
+package playbook
+
+import (
+  "bytes"
+  "crypto/md5"
+  "crypto/sha1"
+  "crypto/sha256"
+  "crypto/sha512"
+  "encoding/base64"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "hash"
+  "math/big"
+  "net"
+  "reflect"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "github.com/smallfish/simpleyaml"
+  "../inventory"
+)
+
+// FilterFunc is a jinja2 filter, which is given the value being filtered
+// along with the positional and keyword arguments from the template
+type FilterFunc func(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error)
+
+// all of the filters available to templates, the built-in filters are
+// added here and filter plugins are added with RegisterFilters
+var filters = make(map[string]FilterFunc)
+
+func init() {
+  RegisterFilters(map[string]FilterFunc{
+    "default": filterDefault,
+    "d": filterDefault,
+    "bool": filterBool,
+    "to_json": filterToJson,
+    "to_nice_json": filterToNiceJson,
+    "from_json": filterFromJson,
+    "from_yaml": filterFromYaml,
+    "regex_replace": filterRegexReplace,
+    "combine": filterCombine,
+    "dict2items": filterDict2Items,
+    "items2dict": filterItems2Dict,
+    "select": filterSelect,
+    "reject": filterReject,
+    "selectattr": filterSelectAttr,
+    "rejectattr": filterRejectAttr,
+    "map": filterMap,
+    "ipaddr": filterIpaddr,
+    "ipv4": filterIpv4,
+    "ipv6": filterIpv6,
+    "b64encode": filterB64Encode,
+    "b64decode": filterB64Decode,
+    "hash": filterHash,
+    "checksum": filterChecksum,
+    "md5": filterMd5,
+    "sha1": filterSha1,
+    "basename": filterBasename,
+    "dirname": filterDirname,
+    "quote": filterQuote,
+  })
+}
+
+// RegisterFilters adds filters to every template,
+// replacing any existing filters with the same name
+func RegisterFilters(new_filters map[string]FilterFunc) {
+  for name, f := range new_filters {
+    filters[name] = f
+  }
+}
+
+// returns a filter argument given either by position or by name,
+// a negative position means the argument may only be given by name
+func filterArg(args []interface{}, kwargs map[string]interface{}, pos int, name string, def interface{}) interface{} {
+  if pos >= 0 && pos < len(args) {
+    return args[pos]
+  }
+  if value, ok := kwargs[name]; ok {
+    return value
+  }
+  return def
+}
+
+// the string python would give for a value, so that
+// filters produce the same results as they do there
+func pythonString(value interface{}) string {
+  switch v := value.(type) {
+  case nil:
+    return "None"
+  case string:
+    return v
+  case bool:
+    if v {
+      return "True"
+    }
+    return "False"
+  }
+  return fmt.Sprint(value)
+}
+
+// truthiness as python sees it
+func isTrue(value interface{}) bool {
+  switch v := value.(type) {
+  case nil:
+    return false
+  case bool:
+    return v
+  case string:
+    return v != ""
+  }
+  if f, ok := toFloat(value); ok {
+    return f != 0
+  }
+  rv := reflect.ValueOf(value)
+  switch rv.Kind() {
+  case reflect.Slice, reflect.Map, reflect.Array:
+    return rv.Len() > 0
+  }
+  return true
+}
+
+func toFloat(value interface{}) (float64, bool) {
+  switch v := value.(type) {
+  case int:
+    return float64(v), true
+  case int64:
+    return float64(v), true
+  case float64:
+    return v, true
+  }
+  return 0, false
+}
+
+func toInt(value interface{}) (int, bool) {
+  switch v := value.(type) {
+  case int:
+    return v, true
+  case int64:
+    return int(v), true
+  case float64:
+    return int(v), true
+  case string:
+    if i, err := strconv.Atoi(v); err == nil {
+      return i, true
+    }
+  }
+  return 0, false
+}
+
+// numbers are equal regardless of whether they are ints or floats
+func valuesEqual(a interface{}, b interface{}) bool {
+  if fa, ok := toFloat(a); ok {
+    if fb, ok := toFloat(b); ok {
+      return fa == fb
+    }
+  }
+  return reflect.DeepEqual(inventory.NormalizeValue(a), inventory.NormalizeValue(b))
+}
+
+func toList(value interface{}, filter string) ([]interface{}, error) {
+  switch v := value.(type) {
+  case []interface{}:
+    return v, nil
+  case []string:
+    return toInterfaceList(v), nil
+  case map[string]interface{}:
+    // as with python, iterating over a dictionary gives its keys
+    return toInterfaceList(sortedKeys(v)), nil
+  }
+  return nil, fmt.Errorf("%s expects a list, got %s", filter, TypeOf(value))
+}
+
+func toMap(value interface{}, filter string) (map[string]interface{}, error) {
+  if v, ok := inventory.NormalizeValue(value).(map[string]interface{}); ok {
+    return v, nil
+  }
+  return nil, fmt.Errorf("%s expects a dictionary, got %s", filter, TypeOf(value))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+  keys := make([]string, 0, len(m))
+  for k, _ := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// default(default_value='', boolean=False), an undefined value is nil
+func filterDefault(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  default_value := filterArg(args, kwargs, 0, "default_value", "")
+  boolean := isTrue(filterArg(args, kwargs, 1, "boolean", false))
+  if value == nil || (boolean && !isTrue(value)) {
+    return default_value, nil
+  }
+  return value, nil
+}
+
+func filterBool(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  if v, ok := value.(bool); ok {
+    return v, nil
+  }
+  switch strings.ToLower(pythonString(value)) {
+  case "yes", "on", "1", "true":
+    return true, nil
+  }
+  return false, nil
+}
+
+// to_json(indent=None), dictionary keys are always sorted
+func filterToJson(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  indent := 0
+  if v := filterArg(args, kwargs, -1, "indent", nil); v != nil {
+    if i, ok := toInt(v); ok {
+      indent = i
+    }
+  }
+  return toJson(inventory.NormalizeValue(value), indent, 0)
+}
+
+func filterToNiceJson(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  indent := 4
+  if i, ok := toInt(filterArg(args, kwargs, -1, "indent", 4)); ok {
+    indent = i
+  }
+  return toJson(inventory.NormalizeValue(value), indent, 0)
+}
+
+// encodes the value as python's json.dumps does, which puts
+// spaces after the separators when there is no indent
+func toJson(value interface{}, indent int, level int) (string, error) {
+  item_sep := ", "
+  prefix := ""
+  closing := ""
+  if indent > 0 {
+    item_sep = ","
+    prefix = "\n" + strings.Repeat(" ", indent * (level + 1))
+    closing = "\n" + strings.Repeat(" ", indent * level)
+  }
+  switch v := value.(type) {
+  case []string:
+    return toJson(toInterfaceList(v), indent, level)
+  case []interface{}:
+    if len(v) == 0 {
+      return "[]", nil
+    }
+    items := make([]string, len(v))
+    for i, item := range v {
+      res, err := toJson(item, indent, level + 1)
+      if err != nil {
+        return "", err
+      }
+      items[i] = prefix + res
+    }
+    return "[" + strings.Join(items, item_sep) + closing + "]", nil
+  case map[string]interface{}:
+    if len(v) == 0 {
+      return "{}", nil
+    }
+    items := make([]string, 0, len(v))
+    for _, k := range sortedKeys(v) {
+      key, _ := toJson(k, indent, level + 1)
+      res, err := toJson(v[k], indent, level + 1)
+      if err != nil {
+        return "", err
+      }
+      items = append(items, prefix + key + ": " + res)
+    }
+    return "{" + strings.Join(items, item_sep) + closing + "}", nil
+  }
+  var buf bytes.Buffer
+  encoder := json.NewEncoder(&buf)
+  encoder.SetEscapeHTML(false)
+  if err := encoder.Encode(value); err != nil {
+    return "", fmt.Errorf("to_json: %s", err)
+  }
+  return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func filterFromJson(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  var res interface{}
+  decoder := json.NewDecoder(strings.NewReader(pythonString(value)))
+  decoder.UseNumber()
+  if err := decoder.Decode(&res); err != nil {
+    return nil, fmt.Errorf("from_json: %s", err)
+  }
+  return inventory.NormalizeValue(res), nil
+}
+
+func filterFromYaml(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  data, ok := value.(string)
+  if !ok {
+    // python's from_yaml leaves anything which isn't a string alone
+    return value, nil
+  }
+  yaml_data, err := simpleyaml.NewYaml([]byte(data))
+  if err != nil {
+    return nil, fmt.Errorf("from_yaml: %s", err)
+  }
+  if dict, err := yaml_data.Map(); err == nil {
+    return inventory.NormalizeValue(dict), nil
+  }
+  if list, err := yaml_data.Array(); err == nil {
+    return inventory.NormalizeValue(list), nil
+  }
+  if i, err := yaml_data.Int(); err == nil {
+    return i, nil
+  }
+  if f, err := yaml_data.Float(); err == nil {
+    return f, nil
+  }
+  if b, err := yaml_data.Bool(); err == nil {
+    return b, nil
+  }
+  if str, err := yaml_data.String(); err == nil {
+    return str, nil
+  }
+  return nil, nil
+}
+
+var python_backref_re = regexp.MustCompile(`\\(\d+)|\\g<(\w+)>`)
+
+// regex_replace(pattern, replacement='', ignorecase=False, multiline=False),
+// the replacement uses python's \1 and \g<name> back references
+func filterRegexReplace(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  pattern := pythonString(filterArg(args, kwargs, 0, "pattern", ""))
+  replacement := pythonString(filterArg(args, kwargs, 1, "replacement", ""))
+  flags := ""
+  if isTrue(filterArg(args, kwargs, 2, "ignorecase", false)) {
+    flags += "i"
+  }
+  if isTrue(filterArg(args, kwargs, 3, "multiline", false)) {
+    flags += "m"
+  }
+  if flags != "" {
+    pattern = "(?" + flags + ")" + pattern
+  }
+  re, err := regexp.Compile(pattern)
+  if err != nil {
+    return nil, fmt.Errorf("regex_replace: invalid pattern: %s", err)
+  }
+  replacement = strings.Replace(replacement, "$", "$$", -1)
+  replacement = python_backref_re.ReplaceAllString(replacement, "$${$1$2}")
+  return re.ReplaceAllString(pythonString(value), replacement), nil
+}
+
+// combine(*dicts, recursive=False, list_merge='replace'), the value
+// may also be a list of the dictionaries to combine
+func filterCombine(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  recursive := isTrue(filterArg(args, kwargs, -1, "recursive", false))
+  list_merge := pythonString(filterArg(args, kwargs, -1, "list_merge", "replace"))
+  switch list_merge {
+  case "replace", "keep", "append", "prepend", "append_rp", "prepend_rp":
+  default:
+    return nil, fmt.Errorf("combine: list_merge must be one of replace, keep, append, prepend, append_rp or prepend_rp, not %s", list_merge)
+  }
+
+  dicts := make([]interface{}, 0)
+  if list, ok := value.([]interface{}); ok {
+    dicts = append(dicts, list...)
+  } else {
+    dicts = append(dicts, value)
+  }
+  dicts = append(dicts, args...)
+
+  res := make(map[string]interface{})
+  for _, d := range dicts {
+    m, err := toMap(d, "combine")
+    if err != nil {
+      return nil, err
+    }
+    res = combineMaps(res, m, recursive, list_merge)
+  }
+  return res, nil
+}
+
+func combineMaps(a map[string]interface{}, b map[string]interface{}, recursive bool, list_merge string) map[string]interface{} {
+  res := make(map[string]interface{})
+  for k, v := range a {
+    res[k] = v
+  }
+  for k, v := range b {
+    cur, ok := res[k]
+    if !ok {
+      res[k] = v
+      continue
+    }
+    cur_map, cur_is_map := cur.(map[string]interface{})
+    new_map, new_is_map := v.(map[string]interface{})
+    cur_list, cur_is_list := cur.([]interface{})
+    new_list, new_is_list := v.([]interface{})
+    switch {
+    case recursive && cur_is_map && new_is_map:
+      res[k] = combineMaps(cur_map, new_map, recursive, list_merge)
+    case cur_is_list && new_is_list:
+      res[k] = mergeLists(cur_list, new_list, list_merge)
+    default:
+      res[k] = v
+    }
+  }
+  return res
+}
+
+func mergeLists(a []interface{}, b []interface{}, list_merge string) []interface{} {
+  // the items of a which are not also in b
+  remaining := func() []interface{} {
+    res := make([]interface{}, 0)
+    for _, item := range a {
+      found := false
+      for _, other := range b {
+        if valuesEqual(item, other) {
+          found = true
+          break
+        }
+      }
+      if !found {
+        res = append(res, item)
+      }
+    }
+    return res
+  }
+  switch list_merge {
+  case "keep":
+    return a
+  case "append":
+    return append(append([]interface{}{}, a...), b...)
+  case "prepend":
+    return append(append([]interface{}{}, b...), a...)
+  case "append_rp":
+    return append(remaining(), b...)
+  case "prepend_rp":
+    return append(append([]interface{}{}, b...), remaining()...)
+  }
+  return b
+}
+
+// dict2items(key_name='key', value_name='value'), the items are sorted by key
+func filterDict2Items(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  key_name := pythonString(filterArg(args, kwargs, 0, "key_name", "key"))
+  value_name := pythonString(filterArg(args, kwargs, 1, "value_name", "value"))
+  m, err := toMap(value, "dict2items")
+  if err != nil {
+    return nil, err
+  }
+  res := make([]interface{}, 0, len(m))
+  for _, k := range sortedKeys(m) {
+    res = append(res, map[string]interface{}{key_name: k, value_name: m[k]})
+  }
+  return res, nil
+}
+
+func filterItems2Dict(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  key_name := pythonString(filterArg(args, kwargs, 0, "key_name", "key"))
+  value_name := pythonString(filterArg(args, kwargs, 1, "value_name", "value"))
+  list, err := toList(value, "items2dict")
+  if err != nil {
+    return nil, err
+  }
+  res := make(map[string]interface{})
+  for _, item := range list {
+    m, err := toMap(item, "items2dict")
+    if err != nil {
+      return nil, err
+    }
+    k, ok := m[key_name]
+    if !ok {
+      return nil, fmt.Errorf("items2dict: item has no '%s' key", key_name)
+    }
+    res[pythonString(k)] = m[value_name]
+  }
+  return res, nil
+}
+
+// applies the test named in args (or truthiness, when there is
+// none) to the item, with any remaining args passed to the test
+func selectTest(item interface{}, args []interface{}) (bool, error) {
+  if len(args) == 0 {
+    return isTrue(item), nil
+  }
+  return applyTest(pythonString(args[0]), item, args[1:])
+}
+
+func selectItems(value interface{}, filter string, keep bool, get func(interface{}) interface{}, args []interface{}) (interface{}, error) {
+  list, err := toList(value, filter)
+  if err != nil {
+    return nil, err
+  }
+  res := make([]interface{}, 0)
+  for _, item := range list {
+    ok, err := selectTest(get(item), args)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %s", filter, err)
+    }
+    if ok == keep {
+      res = append(res, item)
+    }
+  }
+  return res, nil
+}
+
+func itself(item interface{}) interface{} {
+  return item
+}
+
+// gets a (possibly dotted) attribute of an item, nil if it is not defined
+func itemAttribute(attr string) func(interface{}) interface{} {
+  return func(item interface{}) interface{} {
+    if m, ok := inventory.NormalizeValue(item).(map[string]interface{}); ok {
+      if res, ok := lookupVariable(m, attr); ok {
+        return res
+      }
+    }
+    return nil
+  }
+}
+
+func filterSelect(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return selectItems(value, "select", true, itself, args)
+}
+
+func filterReject(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return selectItems(value, "reject", false, itself, args)
+}
+
+// selectattr(attribute, test=None, *args)
+func filterSelectAttr(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  if len(args) == 0 {
+    return nil, fmt.Errorf("selectattr: missing attribute")
+  }
+  return selectItems(value, "selectattr", true, itemAttribute(pythonString(args[0])), args[1:])
+}
+
+func filterRejectAttr(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  if len(args) == 0 {
+    return nil, fmt.Errorf("rejectattr: missing attribute")
+  }
+  return selectItems(value, "rejectattr", false, itemAttribute(pythonString(args[0])), args[1:])
+}
+
+// map(attribute='name', default=None) or map('filter', *args, **kwargs)
+func filterMap(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  list, err := toList(value, "map")
+  if err != nil {
+    return nil, err
+  }
+  res := make([]interface{}, len(list))
+  if attr, ok := kwargs["attribute"]; ok {
+    get := itemAttribute(pythonString(attr))
+    default_value, has_default := kwargs["default"]
+    for i, item := range list {
+      res[i] = get(item)
+      if res[i] == nil && has_default {
+        res[i] = default_value
+      }
+    }
+    return res, nil
+  }
+  if len(args) == 0 {
+    return nil, fmt.Errorf("map: missing the filter or attribute to apply")
+  }
+  name := pythonString(args[0])
+  f, ok := filters[name]
+  if !ok {
+    return nil, fmt.Errorf("map: no filter named '%s'", name)
+  }
+  for i, item := range list {
+    res[i], err = f(item, args[1:], kwargs)
+    if err != nil {
+      return nil, err
+    }
+  }
+  return res, nil
+}
+
+// ipaddr(query=''), a small part of the netaddr based filter, which
+// understands single addresses and networks in CIDR notation. Invalid
+// addresses give False, and lists are filtered to the valid addresses.
+func filterIpaddr(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return ipaddrFilter(value, pythonString(filterArg(args, kwargs, 0, "query", "")), 0)
+}
+
+func filterIpv4(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return ipaddrFilter(value, pythonString(filterArg(args, kwargs, 0, "query", "")), 4)
+}
+
+func filterIpv6(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return ipaddrFilter(value, pythonString(filterArg(args, kwargs, 0, "query", "")), 6)
+}
+
+func ipaddrFilter(value interface{}, query string, version int) (interface{}, error) {
+  switch value.(type) {
+  case []interface{}, []string:
+    list, _ := toList(value, "ipaddr")
+    res := make([]interface{}, 0)
+    for _, item := range list {
+      r, err := ipaddrQuery(item, query, version)
+      if err != nil {
+        return nil, err
+      }
+      if r != false {
+        res = append(res, r)
+      }
+    }
+    return res, nil
+  }
+  return ipaddrQuery(value, query, version)
+}
+
+func ipaddrQuery(value interface{}, query string, version int) (interface{}, error) {
+  s, ok := value.(string)
+  if !ok {
+    return false, nil
+  }
+  var ip net.IP
+  var network *net.IPNet
+  if strings.Contains(s, "/") {
+    var err error
+    if ip, network, err = net.ParseCIDR(s); err != nil {
+      return false, nil
+    }
+  } else {
+    if ip = net.ParseIP(s); ip == nil {
+      return false, nil
+    }
+    bits := 128
+    if ip.To4() != nil {
+      bits = 32
+    }
+    network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+  }
+  is_v4 := ip.To4() != nil
+  if (version == 4 && !is_v4) || (version == 6 && is_v4) {
+    return false, nil
+  }
+  ones, bits := network.Mask.Size()
+
+  switch query {
+  case "":
+    return s, nil
+  case "address":
+    return ip.String(), nil
+  case "host":
+    return fmt.Sprintf("%s/%d", ip, ones), nil
+  case "network":
+    return network.IP.String(), nil
+  case "netmask":
+    return net.IP(network.Mask).String(), nil
+  case "prefix":
+    return ones, nil
+  case "net", "subnet":
+    return network.String(), nil
+  case "broadcast":
+    broadcast := make(net.IP, len(network.IP))
+    for i, b := range network.IP {
+      broadcast[i] = b | ^network.Mask[i]
+    }
+    return broadcast.String(), nil
+  case "size":
+    size := new(big.Int).Lsh(big.NewInt(1), uint(bits - ones))
+    if size.IsInt64() {
+      return int(size.Int64()), nil
+    }
+    return size.String(), nil
+  case "version":
+    if is_v4 {
+      return 4, nil
+    }
+    return 6, nil
+  case "ipv4", "4":
+    if is_v4 {
+      return s, nil
+    }
+    return false, nil
+  case "ipv6", "6":
+    if !is_v4 {
+      return s, nil
+    }
+    return false, nil
+  case "private":
+    if ip.IsPrivate() {
+      return s, nil
+    }
+    return false, nil
+  case "public":
+    if ip.IsGlobalUnicast() && !ip.IsPrivate() {
+      return s, nil
+    }
+    return false, nil
+  case "loopback":
+    if ip.IsLoopback() {
+      return s, nil
+    }
+    return false, nil
+  }
+  return nil, fmt.Errorf("ipaddr: unknown query '%s'", query)
+}
+
+func filterB64Encode(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return base64.StdEncoding.EncodeToString([]byte(pythonString(value))), nil
+}
+
+func filterB64Decode(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  res, err := base64.StdEncoding.DecodeString(pythonString(value))
+  if err != nil {
+    return nil, fmt.Errorf("b64decode: %s", err)
+  }
+  return string(res), nil
+}
+
+var hash_types = map[string]func() hash.Hash{
+  "md5": md5.New,
+  "sha1": sha1.New,
+  "sha224": sha256.New224,
+  "sha256": sha256.New,
+  "sha384": sha512.New384,
+  "sha512": sha512.New,
+}
+
+func hexDigest(value interface{}, hashtype string) (interface{}, error) {
+  new_hash, ok := hash_types[hashtype]
+  if !ok {
+    return nil, fmt.Errorf("hash: unsupported hash type '%s'", hashtype)
+  }
+  h := new_hash()
+  h.Write([]byte(pythonString(value)))
+  return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hash(hashtype='sha1')
+func filterHash(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return hexDigest(value, pythonString(filterArg(args, kwargs, 0, "hashtype", "sha1")))
+}
+
+func filterChecksum(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return hexDigest(value, "sha1")
+}
+
+func filterMd5(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return hexDigest(value, "md5")
+}
+
+func filterSha1(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  return hexDigest(value, "sha1")
+}
+
+// as with python's os.path.basename, "/a/b/" gives ""
+func filterBasename(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  path := pythonString(value)
+  return path[strings.LastIndex(path, "/") + 1:], nil
+}
+
+// as with python's os.path.dirname, "/a/b/" gives "/a/b"
+func filterDirname(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  path := pythonString(value)
+  head := path[:strings.LastIndex(path, "/") + 1]
+  if trimmed := strings.TrimRight(head, "/"); trimmed != "" {
+    head = trimmed
+  }
+  return head, nil
+}
+
+var shell_unsafe_re = regexp.MustCompile(`[^\w@%+=:,./-]`)
+
+// quotes the value for the shell, as python's shlex.quote
+func filterQuote(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+  s := pythonString(value)
+  if s == "" {
+    return "''", nil
+  }
+  if !shell_unsafe_re.MatchString(s) {
+    return s, nil
+  }
+  return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'", nil
+}
@@ -0,0 +1,213 @@
+package playbook
+
+import (
+  "reflect"
+  "strings"
+  "testing"
+)
+
+type filterTest struct {
+  filter string
+  value interface{}
+  args []interface{}
+  kwargs map[string]interface{}
+  want interface{}
+  err string
+}
+
+var filter_tests = []filterTest{
+  // default
+  {filter: "default", value: nil, args: []interface{}{"x"}, want: "x"},
+  {filter: "default", value: nil, want: ""},
+  {filter: "d", value: "set", args: []interface{}{"x"}, want: "set"},
+  {filter: "default", value: "", args: []interface{}{"x"}, want: ""},
+  {filter: "default", value: "", args: []interface{}{"x", true}, want: "x"},
+  {filter: "default", value: 0, args: []interface{}{"x"}, kwargs: map[string]interface{}{"boolean": true}, want: "x"},
+
+  // bool
+  {filter: "bool", value: "yes", want: true},
+  {filter: "bool", value: "True", want: true},
+  {filter: "bool", value: 1, want: true},
+  {filter: "bool", value: "no", want: false},
+  {filter: "bool", value: false, want: false},
+
+  // to_json, to_nice_json, from_json and from_yaml
+  {filter: "to_json", value: map[string]interface{}{"b": []interface{}{1, "x"}, "a": nil}, want: `{"a": null, "b": [1, "x"]}`},
+  {filter: "to_json", value: "<&>", want: `"<&>"`},
+  {filter: "to_json", value: []interface{}{1}, kwargs: map[string]interface{}{"indent": 2}, want: "[\n  1\n]"},
+  {filter: "to_nice_json", value: map[string]interface{}{"a": 1}, want: "{\n    \"a\": 1\n}"},
+  {filter: "to_nice_json", value: map[string]interface{}{}, want: "{}"},
+  {filter: "from_json", value: `{"a": [1, 2.5, "x"], "b": true}`, want: map[string]interface{}{"a": []interface{}{1, 2.5, "x"}, "b": true}},
+  {filter: "from_json", value: `{"a":`, err: "from_json"},
+  {filter: "from_yaml", value: "a: 1\nb: [x, z]\n", want: map[string]interface{}{"a": 1, "b": []interface{}{"x", "z"}}},
+  {filter: "from_yaml", value: "- 1\n- 2\n", want: []interface{}{1, 2}},
+  {filter: "from_yaml", value: "12", want: 12},
+  {filter: "from_yaml", value: "text", want: "text"},
+  {filter: "from_yaml", value: 5, want: 5},
+
+  // regex_replace
+  {filter: "regex_replace", value: "hello world", args: []interface{}{"o", "0"}, want: "hell0 w0rld"},
+  {filter: "regex_replace", value: "web01", args: []interface{}{`^(\w+?)(\d+)$`, `\2-\1`}, want: "01-web"},
+  {filter: "regex_replace", value: "web01", args: []interface{}{`(?P<name>[a-z]+)`, `\g<name>$`}, want: "web$01"},
+  {filter: "regex_replace", value: "ABC", args: []interface{}{"b", "x"}, kwargs: map[string]interface{}{"ignorecase": true}, want: "AxC"},
+  {filter: "regex_replace", value: "a", args: []interface{}{"("}, err: "invalid pattern"},
+
+  // combine
+  {
+    filter: "combine",
+    value: map[string]interface{}{"a": 1, "b": map[string]interface{}{"x": 1}},
+    args: []interface{}{map[string]interface{}{"b": map[string]interface{}{"y": 2}, "c": 3}},
+    want: map[string]interface{}{"a": 1, "b": map[string]interface{}{"y": 2}, "c": 3},
+  },
+  {
+    filter: "combine",
+    value: map[string]interface{}{"b": map[string]interface{}{"x": 1}},
+    args: []interface{}{map[string]interface{}{"b": map[string]interface{}{"y": 2}}},
+    kwargs: map[string]interface{}{"recursive": true},
+    want: map[string]interface{}{"b": map[string]interface{}{"x": 1, "y": 2}},
+  },
+  {
+    filter: "combine",
+    value: []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}},
+    want: map[string]interface{}{"a": 2},
+  },
+  {
+    filter: "combine",
+    value: map[string]interface{}{"a": []interface{}{1, 2}},
+    args: []interface{}{map[string]interface{}{"a": []interface{}{2, 3}}},
+    kwargs: map[string]interface{}{"list_merge": "append_rp"},
+    want: map[string]interface{}{"a": []interface{}{1, 2, 3}},
+  },
+  {
+    filter: "combine",
+    value: map[string]interface{}{"a": []interface{}{1}},
+    args: []interface{}{map[string]interface{}{"a": []interface{}{2}}},
+    kwargs: map[string]interface{}{"list_merge": "prepend"},
+    want: map[string]interface{}{"a": []interface{}{2, 1}},
+  },
+  {filter: "combine", value: map[string]interface{}{}, kwargs: map[string]interface{}{"list_merge": "bad"}, err: "list_merge must be one of"},
+  {filter: "combine", value: "text", err: "combine expects a dictionary"},
+
+  // dict2items and items2dict
+  {
+    filter: "dict2items",
+    value: map[string]interface{}{"b": 2, "a": 1},
+    want: []interface{}{map[string]interface{}{"key": "a", "value": 1}, map[string]interface{}{"key": "b", "value": 2}},
+  },
+  {
+    filter: "dict2items",
+    value: map[string]interface{}{"a": 1},
+    kwargs: map[string]interface{}{"key_name": "k", "value_name": "v"},
+    want: []interface{}{map[string]interface{}{"k": "a", "v": 1}},
+  },
+  {
+    filter: "items2dict",
+    value: []interface{}{map[string]interface{}{"key": "a", "value": 1}, map[string]interface{}{"key": "b", "value": 2}},
+    want: map[string]interface{}{"a": 1, "b": 2},
+  },
+  {filter: "items2dict", value: []interface{}{map[string]interface{}{"value": 1}}, err: "item has no 'key' key"},
+  {filter: "dict2items", value: []interface{}{}, err: "dict2items expects a dictionary"},
+
+  // select, reject, selectattr, rejectattr and map
+  {filter: "select", value: []interface{}{0, 1, "", "a", nil}, want: []interface{}{1, "a"}},
+  {filter: "reject", value: []interface{}{0, 1, "", "a"}, want: []interface{}{0, ""}},
+  {filter: "select", value: []interface{}{"web1", "db1", "web2"}, args: []interface{}{"match", "web"}, want: []interface{}{"web1", "web2"}},
+  {filter: "select", value: []interface{}{1}, args: []interface{}{"nosuch"}, err: "no test named 'nosuch'"},
+  {
+    filter: "selectattr",
+    value: []interface{}{map[string]interface{}{"n": "a", "on": true}, map[string]interface{}{"n": "b", "on": false}},
+    args: []interface{}{"on"},
+    want: []interface{}{map[string]interface{}{"n": "a", "on": true}},
+  },
+  {
+    filter: "rejectattr",
+    value: []interface{}{map[string]interface{}{"n": "a"}, map[string]interface{}{"n": "b", "x": 1}},
+    args: []interface{}{"x", "defined"},
+    want: []interface{}{map[string]interface{}{"n": "a"}},
+  },
+  {filter: "selectattr", value: []interface{}{}, err: "missing attribute"},
+  {
+    filter: "map",
+    value: []interface{}{map[string]interface{}{"n": "a"}, map[string]interface{}{"x": 1}},
+    kwargs: map[string]interface{}{"attribute": "n", "default": "none"},
+    want: []interface{}{"a", "none"},
+  },
+  {filter: "map", value: []interface{}{"/a/b", "/c/d"}, args: []interface{}{"basename"}, want: []interface{}{"b", "d"}},
+  {filter: "map", value: []interface{}{1}, args: []interface{}{"nosuch"}, err: "no filter named 'nosuch'"},
+  {filter: "map", value: "text", args: []interface{}{"basename"}, err: "map expects a list"},
+
+  // ipaddr, ipv4 and ipv6
+  {filter: "ipaddr", value: "192.168.1.10", want: "192.168.1.10"},
+  {filter: "ipaddr", value: "not an address", want: false},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"network"}, want: "192.168.1.0"},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"netmask"}, want: "255.255.255.0"},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"broadcast"}, want: "192.168.1.255"},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"prefix"}, want: 24},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"size"}, want: 256},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"net"}, want: "192.168.1.0/24"},
+  {filter: "ipaddr", value: "192.168.1.10/24", args: []interface{}{"address"}, want: "192.168.1.10"},
+  {filter: "ipaddr", value: "10.0.0.1", args: []interface{}{"private"}, want: "10.0.0.1"},
+  {filter: "ipaddr", value: "8.8.8.8", args: []interface{}{"private"}, want: false},
+  {filter: "ipaddr", value: []interface{}{"10.0.0.1", "nope", "::1"}, want: []interface{}{"10.0.0.1", "::1"}},
+  {filter: "ipaddr", value: "10.0.0.1", args: []interface{}{"nosuch"}, err: "unknown query 'nosuch'"},
+  {filter: "ipv4", value: []interface{}{"10.0.0.1", "::1"}, want: []interface{}{"10.0.0.1"}},
+  {filter: "ipv6", value: []interface{}{"10.0.0.1", "::1"}, want: []interface{}{"::1"}},
+
+  // encoding and hashing
+  {filter: "b64encode", value: "hello", want: "aGVsbG8="},
+  {filter: "b64decode", value: "aGVsbG8=", want: "hello"},
+  {filter: "b64decode", value: "!!", err: "b64decode"},
+  {filter: "md5", value: "hello", want: "5d41402abc4b2a76b9719d911017c592"},
+  {filter: "sha1", value: "hello", want: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+  {filter: "checksum", value: "hello", want: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+  {filter: "hash", value: "hello", args: []interface{}{"sha256"}, want: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+  {filter: "hash", value: "hello", args: []interface{}{"nosuch"}, err: "unsupported hash type"},
+
+  // paths and quoting
+  {filter: "basename", value: "/etc/hosts", want: "hosts"},
+  {filter: "basename", value: "/etc/", want: ""},
+  {filter: "dirname", value: "/etc/hosts", want: "/etc"},
+  {filter: "dirname", value: "/a/b/", want: "/a/b"},
+  {filter: "dirname", value: "/hosts", want: "/"},
+  {filter: "dirname", value: "hosts", want: ""},
+  {filter: "quote", value: "simple", want: "simple"},
+  {filter: "quote", value: "", want: "''"},
+  {filter: "quote", value: "it's here", want: `'it'"'"'s here'`},
+}
+
+func TestFilters(t *testing.T) {
+  for _, test := range filter_tests {
+    f, ok := filters[test.filter]
+    if !ok {
+      t.Errorf("no filter named '%s'", test.filter)
+      continue
+    }
+    kwargs := test.kwargs
+    if kwargs == nil {
+      kwargs = make(map[string]interface{})
+    }
+    got, err := f(test.value, test.args, kwargs)
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("%s(%#v, %v, %v): expected an error containing %q, got %v", test.filter, test.value, test.args, test.kwargs, test.err, err)
+      }
+    } else if err != nil {
+      t.Errorf("%s(%#v, %v, %v): unexpected error: %s", test.filter, test.value, test.args, test.kwargs, err)
+    } else if !reflect.DeepEqual(got, test.want) {
+      t.Errorf("%s(%#v, %v, %v) = %#v, want %#v", test.filter, test.value, test.args, test.kwargs, got, test.want)
+    }
+  }
+}
+
+func TestRegisterFilters(t *testing.T) {
+  RegisterFilters(map[string]FilterFunc{
+    "test_upper": func(value interface{}, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+      return strings.ToUpper(pythonString(value)), nil
+    },
+  })
+  defer delete(filters, "test_upper")
+  got, err := NewTemplar(map[string]interface{}{"name": "world"}).Template("{{ name | test_upper }}")
+  if err != nil || got != "WORLD" {
+    t.Errorf("got %#v, %v, want \"WORLD\"", got, err)
+  }
+}
@@ -0,0 +1,42 @@
+package playbook
+
+// handlers are tasks which only run when they are notified, by
+// their name or by one of the topics they listen to
+var handler_fields = map[string]FieldAttribute{
+  "listen": FieldAttribute{
+    T: "list", Default: nil, Required: false, Priority: 0, Inherit: false, Alias: []string{}, Extend: false, Prepend: false,
+  },
+}
+
+func (t *Task) IsHandler() bool {
+  return t.handler
+}
+
+// local getters
+func (t *Task) Listen() []string {
+  if res, ok := t.Attr_listen.([]string); ok {
+    return res
+  } else {
+    res, _ := handler_fields["listen"].Default.([]string)
+    return res
+  }
+}
+
+// HandlerName is the name a handler is notified by, which
+// is its action when it has no name of its own
+func (t *Task) HandlerName() string {
+  if name := t.Name(); name != "" {
+    return name
+  }
+  return t.Action()
+}
+
+// the generator function for handlers
+func NewHandler(data map[interface{}]interface{}, parent Parent) *Task {
+  t := new(Task)
+  t.handler = true
+  ValidateFields(t, data, true)
+  t.parent = parent
+  t.Load(data)
+  return t
+}
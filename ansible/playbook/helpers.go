@@ -49,7 +49,8 @@ func LoadListOfTasks(task_data_list []interface{}, play *Play, parent Parent, us
         // No include, so this is a task (or a task in a handlers
         // section of the playbook or role)
         if use_handlers {
-          // FIXME do handler stuff
+          new_handler := NewHandler(task_data, parent)
+          task_list = append(task_list, *new_handler)
         } else {
           new_task := NewTask(task_data, parent)
           task_list = append(task_list, *new_task)
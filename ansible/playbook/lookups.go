@@ -0,0 +1,529 @@
+package playbook
+
+import (
+  "crypto/rand"
+  "crypto/sha1"
+  "encoding/binary"
+  "fmt"
+  "io/ioutil"
+  "math/big"
+  math_rand "math/rand"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "sort"
+  "strings"
+  "../inventory"
+)
+
+// LookupFunc runs a lookup with the given terms, returning a list of
+// values. The templar gives lookups the variables and search path of the
+// task. Lookups always run here on the controller, never on the host.
+type LookupFunc func(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error)
+
+// all of the lookups available to templates, the built-in lookups
+// are added here and lookup plugins are added with RegisterLookups
+var lookups = make(map[string]LookupFunc)
+
+func init() {
+  RegisterLookups(map[string]LookupFunc{
+    "file": lookupFile,
+    "env": lookupEnv,
+    "pipe": lookupPipe,
+    "template": lookupTemplate,
+    "fileglob": lookupFileglob,
+    "lines": lookupLines,
+    "password": lookupPassword,
+    "items": lookupItems,
+    "list": lookupList,
+    "flattened": lookupFlattened,
+    "dict": lookupDict,
+    "nested": lookupNested,
+  })
+}
+
+// RegisterLookups adds lookups to every template,
+// replacing any existing lookups with the same name
+func RegisterLookups(new_lookups map[string]LookupFunc) {
+  for name, l := range new_lookups {
+    lookups[name] = l
+  }
+}
+
+// Query runs the named lookup, as query() does in a template
+func (t *Templar) Query(name string, terms []interface{}, kwargs map[string]interface{}) ([]interface{}, error) {
+  lookup, ok := lookups[name]
+  if !ok {
+    return nil, fmt.Errorf("lookup plugin (%s) not found", name)
+  }
+  if kwargs == nil {
+    kwargs = make(map[string]interface{})
+  }
+  return lookup(terms, kwargs, t)
+}
+
+// returns the lookup() (or query(), when wantlist is set) template
+// function, which is called as lookup(name, *terms, **kwargs)
+func (t *Templar) lookupFunction(wantlist bool) func([]interface{}, map[string]interface{}) (interface{}, error) {
+  return func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+    if len(args) == 0 {
+      return nil, fmt.Errorf("lookup requires the name of the lookup plugin")
+    }
+    name := pythonString(args[0])
+    lookup, ok := lookups[name]
+    if !ok {
+      return nil, fmt.Errorf("lookup plugin (%s) not found", name)
+    }
+    lookup_kwargs := make(map[string]interface{})
+    as_list := wantlist
+    errors := "strict"
+    for k, v := range kwargs {
+      switch k {
+      case "wantlist":
+        as_list = as_list || isTrue(v)
+      case "errors":
+        errors = pythonString(v)
+      default:
+        lookup_kwargs[k] = v
+      }
+    }
+
+    ran, err := lookup(args[1:], lookup_kwargs, t)
+    if err != nil {
+      err = fmt.Errorf("An unhandled exception occurred while running the lookup plugin '%s'. Error was: %s", name, err)
+      switch errors {
+      case "ignore":
+        return nil, nil
+      case "warn":
+        fmt.Println("[WARNING]:", err)
+        return nil, nil
+      }
+      return nil, err
+    }
+    if as_list {
+      return ran, nil
+    }
+    // as with python, lookup() joins a list of strings into
+    // one string, and otherwise unwraps a single value
+    strs := make([]string, len(ran))
+    for i, item := range ran {
+      s, ok := item.(string)
+      if !ok {
+        if len(ran) == 1 {
+          return ran[0], nil
+        }
+        return ran, nil
+      }
+      strs[i] = s
+    }
+    if len(ran) == 0 {
+      return ran, nil
+    }
+    return strings.Join(strs, ","), nil
+  }
+}
+
+// the terms as strings, a list given as a term is flattened
+func lookupTerms(terms []interface{}) []string {
+  res := make([]string, 0, len(terms))
+  for _, term := range terms {
+    if list, err := toList(term, "lookup"); err == nil {
+      if _, is_map := term.(map[string]interface{}); !is_map {
+        res = append(res, lookupTerms(list)...)
+        continue
+      }
+    }
+    res = append(res, pythonString(term))
+  }
+  return res
+}
+
+// SearchPath returns the directories relative paths are found in, the
+// role (once roles are loaded) followed by the playbook directory
+func (t *Templar) SearchPath() []string {
+  if paths, ok := t.Vars["ansible_search_path"]; ok {
+    if list, err := toList(paths, "ansible_search_path"); err == nil {
+      return lookupTerms(list)
+    }
+  }
+  search_path := make([]string, 0)
+  for _, name := range []string{"role_path", "playbook_dir"} {
+    if path, ok := t.Vars[name].(string); ok && path != "" {
+      search_path = append(search_path, path)
+    }
+  }
+  if len(search_path) == 0 {
+    if cwd, err := os.Getwd(); err == nil {
+      search_path = append(search_path, cwd)
+    }
+  }
+  return search_path
+}
+
+// FindFile looks for a file in the subdir (such as "files" or
+// "templates") of each directory in the search path, and then in the
+// directory itself. Absolute paths are used as they are.
+func (t *Templar) FindFile(subdir string, name string) (string, error) {
+  if filepath.IsAbs(name) {
+    if _, err := os.Stat(name); err != nil {
+      return "", fmt.Errorf("could not locate file in lookup: %s", name)
+    }
+    return name, nil
+  }
+  for _, dir := range t.SearchPath() {
+    for _, path := range []string{filepath.Join(dir, subdir, name), filepath.Join(dir, name)} {
+      if _, err := os.Stat(path); err == nil {
+        return path, nil
+      }
+    }
+  }
+  return "", fmt.Errorf("could not locate file in lookup: %s", name)
+}
+
+// the directory commands are run in, and relative paths written to
+func (t *Templar) baseDir() string {
+  if search_path := t.SearchPath(); len(search_path) > 0 {
+    return search_path[len(search_path)-1]
+  }
+  return "."
+}
+
+// file(*terms, lstrip=False, rstrip=True)
+func lookupFile(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  lstrip := isTrue(filterArg(nil, kwargs, -1, "lstrip", false))
+  rstrip := isTrue(filterArg(nil, kwargs, -1, "rstrip", true))
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    path, err := templar.FindFile("files", term)
+    if err != nil {
+      return nil, err
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+      return nil, err
+    }
+    contents := string(data)
+    if lstrip {
+      contents = strings.TrimLeft(contents, " \t\r\n")
+    }
+    if rstrip {
+      contents = strings.TrimRight(contents, " \t\r\n")
+    }
+    res = append(res, contents)
+  }
+  return res, nil
+}
+
+// env(*terms, default=''), the environment of the controller
+func lookupEnv(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  default_value := filterArg(nil, kwargs, -1, "default", "")
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    if value, ok := os.LookupEnv(term); ok {
+      res = append(res, value)
+    } else {
+      res = append(res, default_value)
+    }
+  }
+  return res, nil
+}
+
+func runLookupCommand(lookup string, command string, templar *Templar) (string, error) {
+  cmd := exec.Command("/bin/sh", "-c", command)
+  cmd.Dir = templar.baseDir()
+  cmd.Stderr = os.Stderr
+  out, err := cmd.Output()
+  if err != nil {
+    if exit_err, ok := err.(*exec.ExitError); ok {
+      return "", fmt.Errorf("lookup_plugin.%s(%s) returned %d", lookup, command, exit_err.ExitCode())
+    }
+    return "", err
+  }
+  return string(out), nil
+}
+
+// pipe(*terms) runs each term with the shell, returning its output
+func lookupPipe(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    out, err := runLookupCommand("pipe", term, templar)
+    if err != nil {
+      return nil, err
+    }
+    res = append(res, strings.TrimRight(out, " \t\r\n"))
+  }
+  return res, nil
+}
+
+// lines(*terms) runs each term with the shell, returning each line of output
+func lookupLines(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    out, err := runLookupCommand("lines", term, templar)
+    if err != nil {
+      return nil, err
+    }
+    if out == "" {
+      continue
+    }
+    for _, line := range strings.Split(strings.TrimRight(out, "\r\n"), "\n") {
+      res = append(res, strings.TrimRight(line, "\r"))
+    }
+  }
+  return res, nil
+}
+
+// template(*terms, template_vars={}) renders each template with the
+// variables of the task, along with any template_vars given
+func lookupTemplate(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    path, err := templar.FindFile("templates", term)
+    if err != nil {
+      return nil, err
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+      return nil, err
+    }
+    vars := make(map[string]interface{})
+    for k, v := range templar.Vars {
+      vars[k] = v
+    }
+    if template_vars, ok := inventory.NormalizeValue(kwargs["template_vars"]).(map[string]interface{}); ok {
+      for k, v := range template_vars {
+        vars[k] = v
+      }
+    }
+    vars["template_path"] = path
+    vars["template_fullpath"], _ = filepath.Abs(path)
+    file_templar := NewTemplar(vars)
+    file_templar.Strict = templar.Strict
+    rendered, err := file_templar.TemplateString(string(data))
+    if err != nil {
+      return nil, fmt.Errorf("%s: %s", path, err)
+    }
+    res = append(res, rendered)
+  }
+  return res, nil
+}
+
+// fileglob(*terms) returns the files matching each pattern, in the first
+// directory of the search path where there are any
+func lookupFileglob(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    patterns := []string{term}
+    if !filepath.IsAbs(term) {
+      patterns = make([]string, 0)
+      for _, dir := range templar.SearchPath() {
+        patterns = append(patterns, filepath.Join(dir, "files", term), filepath.Join(dir, term))
+      }
+    }
+    for _, pattern := range patterns {
+      matches, err := filepath.Glob(pattern)
+      if err != nil {
+        return nil, fmt.Errorf("fileglob: invalid pattern %s", term)
+      }
+      sort.Strings(matches)
+      found := false
+      for _, match := range matches {
+        if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+          res = append(res, match)
+          found = true
+        }
+      }
+      if found {
+        break
+      }
+    }
+  }
+  return res, nil
+}
+
+const default_password_length = 20
+
+var password_char_sets = map[string]string{
+  "ascii_letters": "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+  "ascii_lowercase": "abcdefghijklmnopqrstuvwxyz",
+  "ascii_uppercase": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+  "digits": "0123456789",
+  "hexdigits": "0123456789abcdefABCDEF",
+  "octdigits": "01234567",
+  "punctuation": "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+// the chars option is a comma separated list of the names of character
+// sets or the characters themselves, where ",," is a literal comma
+func passwordChars(chars string) string {
+  res := ""
+  for _, part := range strings.Split(strings.Replace(chars, ",,", "\x00", -1), ",") {
+    part = strings.Replace(part, "\x00", ",", -1)
+    if set, ok := password_char_sets[part]; ok {
+      res += set
+    } else {
+      res += part
+    }
+  }
+  return res
+}
+
+func generatePassword(length int, chars string, seed string) (string, error) {
+  if chars == "" {
+    return "", fmt.Errorf("no characters to generate the password from")
+  }
+  var seeded *math_rand.Rand
+  if seed != "" {
+    sum := sha1.Sum([]byte(seed))
+    seeded = math_rand.New(math_rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+  }
+  password := make([]byte, length)
+  for i := range password {
+    if seeded != nil {
+      password[i] = chars[seeded.Intn(len(chars))]
+      continue
+    }
+    n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+    if err != nil {
+      return "", err
+    }
+    password[i] = chars[n.Int64()]
+  }
+  return string(password), nil
+}
+
+// password('path length=20 chars=ascii_letters,digits seed=...') returns
+// the password stored in the file, generating it (and creating the file)
+// when it does not exist yet. The path /dev/null never stores the password.
+func lookupPassword(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  res := make([]interface{}, 0)
+  for _, term := range lookupTerms(terms) {
+    params := ParseKV(term, true)
+    path, _ := params["_raw_params"].(string)
+    path = strings.TrimSpace(path)
+    if path == "" {
+      return nil, fmt.Errorf("password: a path is required, as in password('credentials/db length=15')")
+    }
+    for k, v := range kwargs {
+      if _, ok := params[k]; !ok {
+        params[k] = pythonString(v)
+      }
+    }
+    length := default_password_length
+    if value, ok := params["length"]; ok {
+      l, ok := toInt(value)
+      if !ok || l <= 0 {
+        return nil, fmt.Errorf("password: invalid length %v", value)
+      }
+      length = l
+    }
+    chars := passwordChars("ascii_letters,digits,.,,:-_")
+    if value, ok := params["chars"]; ok {
+      chars = passwordChars(pythonString(value))
+    }
+    seed, _ := params["seed"].(string)
+
+    if !filepath.IsAbs(path) {
+      path = filepath.Join(templar.baseDir(), path)
+    }
+    if data, err := ioutil.ReadFile(path); err == nil && path != os.DevNull {
+      // the file may also hold the salt used to encrypt the password
+      password := strings.TrimRight(string(data), "\r\n")
+      if pos := strings.Index(password, " salt="); pos != -1 {
+        password = password[:pos]
+      }
+      res = append(res, password)
+      continue
+    }
+
+    password, err := generatePassword(length, chars, seed)
+    if err != nil {
+      return nil, err
+    }
+    if path != os.DevNull {
+      if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return nil, err
+      }
+      if err := ioutil.WriteFile(path, []byte(password + "\n"), 0600); err != nil {
+        return nil, err
+      }
+    }
+    res = append(res, password)
+  }
+  return res, nil
+}
+
+// flattens lists within the terms, down to the given depth (or
+// completely when the depth is negative)
+func flattenTerms(terms []interface{}, depth int) []interface{} {
+  res := make([]interface{}, 0, len(terms))
+  for _, term := range terms {
+    switch v := term.(type) {
+    case []interface{}, []string:
+      if depth != 0 {
+        list, _ := toList(v, "flatten")
+        res = append(res, flattenTerms(list, depth - 1)...)
+        continue
+      }
+    }
+    res = append(res, term)
+  }
+  return res
+}
+
+// items(*terms) returns the terms, with any lists flattened one level,
+// as used by with_items
+func lookupItems(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  return flattenTerms(terms, 1), nil
+}
+
+// list(*terms) returns the terms as they are
+func lookupList(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  return terms, nil
+}
+
+// flattened(*terms) returns the terms, with all lists flattened
+func lookupFlattened(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  return flattenTerms(terms, -1), nil
+}
+
+// dict(*terms) returns a {key, value} item for each entry of the
+// dictionaries, sorted by key, as used by with_dict
+func lookupDict(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  res := make([]interface{}, 0)
+  for _, term := range terms {
+    items, err := filterDict2Items(term, nil, nil)
+    if err != nil {
+      return nil, fmt.Errorf("with_dict expects a dict")
+    }
+    res = append(res, items.([]interface{})...)
+  }
+  return res, nil
+}
+
+// nested(*lists) returns every combination of an item from each
+// list, as a list in the same order as the lists, as used by with_nested
+func lookupNested(terms []interface{}, kwargs map[string]interface{}, templar *Templar) ([]interface{}, error) {
+  if len(terms) == 0 {
+    return nil, fmt.Errorf("with_nested requires at least one element in the nested list")
+  }
+  combinations := [][]interface{}{[]interface{}{}}
+  for _, term := range terms {
+    list, err := toList(term, "with_nested")
+    if err != nil {
+      list = []interface{}{term}
+    }
+    next := make([][]interface{}, 0, len(combinations) * len(list))
+    for _, combination := range combinations {
+      for _, item := range list {
+        next = append(next, append(append([]interface{}{}, combination...), item))
+      }
+    }
+    combinations = next
+  }
+  res := make([]interface{}, len(combinations))
+  for i, combination := range combinations {
+    res[i] = combination
+  }
+  return res, nil
+}
@@ -0,0 +1,213 @@
+package playbook
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func writeLookupFile(t *testing.T, path string, data string) {
+  t.Helper()
+  if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+    t.Fatal(err)
+  }
+}
+
+// a templar for the files in a temporary playbook directory
+func lookupTemplar(t *testing.T) (*Templar, string) {
+  dir := t.TempDir()
+  writeLookupFile(t, filepath.Join(dir, "files", "motd"), "  welcome\n\n")
+  writeLookupFile(t, filepath.Join(dir, "plain.txt"), "plain")
+  writeLookupFile(t, filepath.Join(dir, "files", "a.conf"), "a")
+  writeLookupFile(t, filepath.Join(dir, "files", "b.conf"), "b")
+  writeLookupFile(t, filepath.Join(dir, "templates", "greeting.j2"), "hello {{ name }}{{ suffix | default('') }}")
+  writeLookupFile(t, filepath.Join(dir, "creds", "stored"), "s3cret salt=abcd\n")
+  templar := NewTemplar(map[string]interface{}{
+    "playbook_dir": dir,
+    "name": "world",
+  })
+  return templar, dir
+}
+
+func TestLookups(t *testing.T) {
+  templar, dir := lookupTemplar(t)
+  os.Setenv("ANSIGO_LOOKUP_TEST", "from env")
+  defer os.Unsetenv("ANSIGO_LOOKUP_TEST")
+
+  tests := []struct {
+    name string
+    lookup string
+    terms []interface{}
+    kwargs map[string]interface{}
+    want []interface{}
+    err string
+  }{
+    {name: "file in files", lookup: "file", terms: []interface{}{"motd"}, want: []interface{}{"  welcome"}},
+    {name: "file lstrip", lookup: "file", terms: []interface{}{"motd"}, kwargs: map[string]interface{}{"lstrip": true}, want: []interface{}{"welcome"}},
+    {name: "file in the playbook dir", lookup: "file", terms: []interface{}{"plain.txt"}, want: []interface{}{"plain"}},
+    {name: "file absolute path", lookup: "file", terms: []interface{}{filepath.Join(dir, "plain.txt")}, want: []interface{}{"plain"}},
+    {name: "file list of terms", lookup: "file", terms: []interface{}{[]interface{}{"plain.txt", "a.conf"}}, want: []interface{}{"plain", "a"}},
+    {name: "missing file", lookup: "file", terms: []interface{}{"nosuch"}, err: "could not locate file in lookup: nosuch"},
+    {name: "env", lookup: "env", terms: []interface{}{"ANSIGO_LOOKUP_TEST"}, want: []interface{}{"from env"}},
+    {name: "env default", lookup: "env", terms: []interface{}{"ANSIGO_LOOKUP_UNSET"}, kwargs: map[string]interface{}{"default": "none"}, want: []interface{}{"none"}},
+    {name: "pipe", lookup: "pipe", terms: []interface{}{"echo hello; echo"}, want: []interface{}{"hello"}},
+    {name: "pipe runs in the playbook dir", lookup: "pipe", terms: []interface{}{"cat plain.txt"}, want: []interface{}{"plain"}},
+    {name: "pipe failure", lookup: "pipe", terms: []interface{}{"exit 3"}, err: "lookup_plugin.pipe(exit 3) returned 3"},
+    {name: "lines", lookup: "lines", terms: []interface{}{"printf 'a\\nb\\n'", "true"}, want: []interface{}{"a", "b"}},
+    {name: "template", lookup: "template", terms: []interface{}{"greeting.j2"}, want: []interface{}{"hello world"}},
+    {
+      name: "template_vars",
+      lookup: "template",
+      terms: []interface{}{"greeting.j2"},
+      kwargs: map[string]interface{}{"template_vars": map[interface{}]interface{}{"suffix": "!"}},
+      want: []interface{}{"hello world!"},
+    },
+    {
+      name: "fileglob",
+      lookup: "fileglob",
+      terms: []interface{}{"*.conf"},
+      want: []interface{}{filepath.Join(dir, "files", "a.conf"), filepath.Join(dir, "files", "b.conf")},
+    },
+    {name: "fileglob without matches", lookup: "fileglob", terms: []interface{}{"*.nosuch"}, want: []interface{}{}},
+    {name: "stored password", lookup: "password", terms: []interface{}{"creds/stored"}, want: []interface{}{"s3cret"}},
+    {name: "password without a path", lookup: "password", terms: []interface{}{"length=5"}, err: "a path is required"},
+    {name: "password invalid length", lookup: "password", terms: []interface{}{"/dev/null length=x"}, err: "invalid length x"},
+    {name: "items", lookup: "items", terms: []interface{}{"a", []interface{}{"b", []interface{}{"c"}}}, want: []interface{}{"a", "b", []interface{}{"c"}}},
+    {name: "list", lookup: "list", terms: []interface{}{"a", []interface{}{"b"}}, want: []interface{}{"a", []interface{}{"b"}}},
+    {name: "flattened", lookup: "flattened", terms: []interface{}{"a", []interface{}{"b", []interface{}{"c"}}}, want: []interface{}{"a", "b", "c"}},
+    {
+      name: "dict",
+      lookup: "dict",
+      terms: []interface{}{map[string]interface{}{"b": 2, "a": 1}},
+      want: []interface{}{
+        map[string]interface{}{"key": "a", "value": 1},
+        map[string]interface{}{"key": "b", "value": 2},
+      },
+    },
+    {name: "dict of a list", lookup: "dict", terms: []interface{}{[]interface{}{1}}, err: "with_dict expects a dict"},
+    {
+      name: "nested",
+      lookup: "nested",
+      terms: []interface{}{[]interface{}{"a", "b"}, []interface{}{1, 2}},
+      want: []interface{}{
+        []interface{}{"a", 1},
+        []interface{}{"a", 2},
+        []interface{}{"b", 1},
+        []interface{}{"b", 2},
+      },
+    },
+    {name: "nested without lists", lookup: "nested", terms: []interface{}{}, err: "requires at least one element"},
+    {name: "unknown lookup", lookup: "nosuch", err: "lookup plugin (nosuch) not found"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      got, err := templar.Query(test.lookup, test.terms, test.kwargs)
+      if test.err != "" {
+        if err == nil || !strings.Contains(err.Error(), test.err) {
+          t.Errorf("expected an error containing %q, got %v", test.err, err)
+        }
+      } else if err != nil {
+        t.Errorf("unexpected error: %s", err)
+      } else if !reflect.DeepEqual(got, test.want) {
+        t.Errorf("got %#v, want %#v", got, test.want)
+      }
+    })
+  }
+}
+
+func TestLookupPassword(t *testing.T) {
+  templar, dir := lookupTemplar(t)
+
+  // a new password is generated and stored in the file
+  got, err := templar.Query("password", []interface{}{"creds/new length=12 chars=digits"}, nil)
+  if err != nil {
+    t.Fatalf("unexpected error: %s", err)
+  }
+  password, _ := got[0].(string)
+  if len(password) != 12 || strings.Trim(password, "0123456789") != "" {
+    t.Errorf("got password %q, want 12 digits", password)
+  }
+  data, err := ioutil.ReadFile(filepath.Join(dir, "creds", "new"))
+  if err != nil || string(data) != password + "\n" {
+    t.Errorf("stored password %q (%v), want %q", data, err, password + "\n")
+  }
+  if again, _ := templar.Query("password", []interface{}{"creds/new"}, nil); !reflect.DeepEqual(again, got) {
+    t.Errorf("second lookup got %#v, want the stored %#v", again, got)
+  }
+
+  // a seeded password is always the same, and /dev/null is never written
+  seeded := []interface{}{"/dev/null seed=host1"}
+  first, _ := templar.Query("password", seeded, nil)
+  second, _ := templar.Query("password", seeded, nil)
+  if !reflect.DeepEqual(first, second) {
+    t.Errorf("seeded passwords differ: %#v and %#v", first, second)
+  }
+  if s, _ := first[0].(string); len(s) != default_password_length {
+    t.Errorf("got password %q, want the default length %d", s, default_password_length)
+  }
+}
+
+func TestPasswordChars(t *testing.T) {
+  tests := []struct {
+    chars string
+    want string
+  }{
+    {"digits", "0123456789"},
+    {"octdigits,xy", "01234567xy"},
+    {"a,,b", "a,b"},
+  }
+  for _, test := range tests {
+    if got := passwordChars(test.chars); got != test.want {
+      t.Errorf("passwordChars(%q) = %q, want %q", test.chars, got, test.want)
+    }
+  }
+}
+
+func TestLookupFunction(t *testing.T) {
+  templar, _ := lookupTemplar(t)
+
+  tests := []struct {
+    name string
+    wantlist bool
+    args []interface{}
+    kwargs map[string]interface{}
+    want interface{}
+    err string
+  }{
+    {name: "strings are joined", args: []interface{}{"list", "a", "b"}, want: "a,b"},
+    {name: "single value is unwrapped", args: []interface{}{"list", 1}, want: 1},
+    {name: "values are kept as a list", args: []interface{}{"list", 1, 2}, want: []interface{}{1, 2}},
+    {name: "no values", args: []interface{}{"list"}, want: []interface{}{}},
+    {name: "wantlist", args: []interface{}{"list", "a", "b"}, kwargs: map[string]interface{}{"wantlist": true}, want: []interface{}{"a", "b"}},
+    {name: "query", wantlist: true, args: []interface{}{"list", "a"}, want: []interface{}{"a"}},
+    {name: "kwargs are passed on", args: []interface{}{"env", "ANSIGO_LOOKUP_UNSET"}, kwargs: map[string]interface{}{"default": "x"}, want: "x"},
+    {name: "errors", args: []interface{}{"file", "nosuch"}, err: "An unhandled exception occurred while running the lookup plugin 'file'"},
+    {name: "ignored errors", args: []interface{}{"file", "nosuch"}, kwargs: map[string]interface{}{"errors": "ignore"}, want: nil},
+    {name: "no lookup name", args: []interface{}{}, err: "lookup requires the name of the lookup plugin"},
+    {name: "unknown lookup", args: []interface{}{"nosuch"}, err: "lookup plugin (nosuch) not found"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      kwargs := test.kwargs
+      if kwargs == nil {
+        kwargs = make(map[string]interface{})
+      }
+      got, err := templar.lookupFunction(test.wantlist)(test.args, kwargs)
+      if test.err != "" {
+        if err == nil || !strings.Contains(err.Error(), test.err) {
+          t.Errorf("expected an error containing %q, got %v", test.err, err)
+        }
+      } else if err != nil {
+        t.Errorf("unexpected error: %s", err)
+      } else if !reflect.DeepEqual(got, test.want) {
+        t.Errorf("got %#v, want %#v", got, test.want)
+      }
+    })
+  }
+}
@@ -0,0 +1,31 @@
+package playbook
+
+// LoopControl holds the loop_control options of a task. The label is
+// templated for each item, so it is kept here as it was written.
+type LoopControl struct {
+  // the variable each item is set as
+  LoopVar string
+  // when set, the variable the index of each item is set as
+  IndexVar string
+  // what is shown for each item instead of the item itself
+  Label interface{}
+  // the number of seconds to wait between items
+  Pause float64
+  // when set, the ansible_loop variable is set for each item
+  Extended bool
+}
+
+func NewLoopControl(data map[string]interface{}) *LoopControl {
+  lc := new(LoopControl)
+  lc.LoopVar = "item"
+  if loop_var, ok := data["loop_var"].(string); ok && loop_var != "" {
+    lc.LoopVar = loop_var
+  }
+  lc.IndexVar, _ = data["index_var"].(string)
+  lc.Label = data["label"]
+  if pause, ok := toFloat(data["pause"]); ok {
+    lc.Pause = pause
+  }
+  lc.Extended = isTrue(data["extended"])
+  return lc
+}
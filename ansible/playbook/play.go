@@ -34,6 +34,8 @@ type Play struct {
 
   // Non-yaml Attributes
   RemovedHosts map[string]bool
+  // set by the end_play meta task, so no more batches are run
+  EndPlay bool
   // role attributes
   //roles []Role
   // block and task lists are read from yaml, but not via
@@ -116,6 +118,11 @@ func (p *Play) Load(data map[interface{}]interface{}) {
     td, _ := data_post_tasks.([]interface{})
     p.Post_tasks = LoadListOfBlocks(td, p, p, false)
   }
+  data_handlers, contains_handlers := data["handlers"]
+  if contains_handlers {
+    td, _ := data_handlers.([]interface{})
+    p.Handlers = LoadListOfBlocks(td, p, p, true)
+  }
 }
 
 func (p *Play) Compile() []Block {
@@ -164,6 +171,14 @@ func (p *Play) GatherSubset() []string {
     return res
   }
 }
+func (p *Play) VarsFiles() []string {
+  if res, ok := p.Attr_vars_files.([]string); ok {
+    return res
+  } else {
+    res, _ := play_fields["vars_files"].Default.([]string)
+    return res
+  }
+}
 func (p *Play) Serial() []int {
   if res, ok := p.Attr_serial.([]int); ok {
     return res
@@ -19,10 +19,9 @@ func (pb *Playbook) Load(file_name string) {
     // FIXME: error handling
   } else {
     if filepath.IsAbs(file_name) {
-      basedir, _ := filepath.Split(file_name)
-      pb.BaseDir = basedir
+      pb.BaseDir = filepath.Dir(file_name)
     } else {
-      pb.BaseDir = filepath.Join(cwd, file_name)
+      pb.BaseDir = filepath.Dir(filepath.Join(cwd, file_name))
     }
     // load any modules relative to the playbook base dir
     EnumerateModules(pb.BaseDir)
@@ -2,6 +2,8 @@ package playbook
 
 import (
   "reflect"
+  "strings"
+  "../inventory"
 )
 
 var task_fields = map[string]FieldAttribute{
@@ -23,12 +25,17 @@ var task_fields = map[string]FieldAttribute{
   "failed_when": FieldAttribute{
     T: "list", Default: nil, Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,
   },
+  // the loop may be a list, or a template which gives one
   "loop": FieldAttribute{
-    T: "list", Default: nil, Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,
+    T: "raw", Default: nil, Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,
+  },
+  "loop_control": FieldAttribute{
+    T: "map", Default: nil, Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,
+  },
+  // the lookup for a with_<lookup> loop, which is given the loop as its terms
+  "loop_with": FieldAttribute{
+    T: "string", Default: "", Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,
   },
-  //"Loop_Control": FieldAttribute{
-  //  T: "struct", Default: nil, Required: false, Priority: 0, Inherit: true, Alias: []string{"async"}, Extend: false, Prepend: false,
-  //},
   "notify": FieldAttribute{
     T: "list", Default: nil, Required: false, Priority: 0, Inherit: true, Alias: []string{}, Extend: false, Prepend: false,
   },
@@ -55,6 +62,8 @@ type Task struct {
 
   // the parent object (a block, or another task)
   parent Parent
+  // set for the tasks in a handlers section
+  handler bool
 
   Attr_action interface{}
   Attr_args interface{}
@@ -67,17 +76,23 @@ type Task struct {
   Attr_delegate_facts interface{}
   Attr_failed_when interface{}
   Attr_loop interface{}
-  //loop_control interface{}
+  Attr_loop_control interface{}
+  Attr_loop_with interface{}
   Attr_notify interface{}
   Attr_poll interface{}
   Attr_register interface{}
   Attr_retries interface{}
   Attr_until interface{}
+  // handler Field Attributes
+  Attr_listen interface{}
 }
 
 func (t *Task) GetAllObjectFieldAttributes() map[string]FieldAttribute {
   var all_fields = make(map[string]FieldAttribute)
   var items = []map[string]FieldAttribute{base_fields, conditional_fields, taggable_fields, become_fields, task_fields}
+  if t.handler {
+    items = append(items, handler_fields)
+  }
   for i := 0; i < len(items); i++ {
     for k, v := range items[i] {
       all_fields[k] = v
@@ -101,18 +116,17 @@ func (t *Task) GetInheritedValue(attr string) interface{} {
     cur_value = nil
   }
 
-  get_parent_value := field_attribute.Inherit &&
-                      t.parent != nil &&
-                      cur_value != reflect.Zero(field.Type()) &&
-                      !(t.squashed || t.finalized)
-  // FIXME: do append and prepend stuff here too, as well as other
-  //        considerations from the python version such as dynamic
-  //        includes, etc.
+  // once squashed the value already includes anything from the parents
+  if t.squashed || t.finalized || t.parent == nil {
+    return cur_value
+  }
+  get_parent_value := field_attribute.Inherit && cur_value == nil
+  // FIXME: consider dynamic includes, etc. as the python version does
   if get_parent_value || field_attribute.Extend {
     parent_value := t.parent.GetInheritedValue(attr)
-    if parent_value != reflect.Zero(field.Type()) && parent_value != nil {
+    if parent_value != nil {
       if field_attribute.Extend && cur_value != nil {
-        cur_value = ExtendValue(cur_value.([]interface{}), parent_value.([]interface{}), field_attribute.Prepend)
+        cur_value = ExtendValue(cur_value, parent_value, field_attribute.Prepend)
       } else {
         cur_value = parent_value
       }
@@ -129,17 +143,18 @@ func (t *Task) Load(data map[interface{}]interface{}) {
   t.Become.Load(data)
 
   LoadValidFields(t, task_fields, data)
-
-  t.Base.GetInheritedValue = t.GetInheritedValue
-  t.Base.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
-  t.Conditional.GetInheritedValue = t.GetInheritedValue
-  t.Conditional.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
-  t.Taggable.GetInheritedValue = t.GetInheritedValue
-  t.Taggable.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
-  t.Become.GetInheritedValue = t.GetInheritedValue
-  t.Become.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
+  if t.handler {
+    LoadValidFields(t, handler_fields, data)
+  }
+  t.bindMixins()
 
   for k, v := range data {
+    if strings.HasPrefix(k.(string), "with_") {
+      t.Attr_loop_with = strings.TrimPrefix(k.(string), "with_")
+      t.Attr_loop = v
+      delete(data, k.(string))
+      continue
+    }
     if _, ok := ModuleCache[k.(string)]; ok || k.(string) == "setup" {
       t.Attr_action = k.(string)
       switch s := TypeOf(v); s {
@@ -169,16 +184,66 @@ func (t *Task) Load(data map[interface{}]interface{}) {
   }
 }
 
-func (t *Task) EvaluateTags(only_tags []string, skip_tags []string) bool {
-  return EvaluateTags(t, only_tags, skip_tags)
+// the mixins call back into the task for inherited values, so this
+// must be done again whenever the task is copied
+func (t *Task) bindMixins() {
+  t.Base.GetInheritedValue = t.GetInheritedValue
+  t.Base.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
+  t.Conditional.GetInheritedValue = t.GetInheritedValue
+  t.Conditional.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
+  t.Taggable.GetInheritedValue = t.GetInheritedValue
+  t.Taggable.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
+  t.Become.GetInheritedValue = t.GetInheritedValue
+  t.Become.GetAllObjectFieldAttributes = t.GetAllObjectFieldAttributes
 }
 
-func (t *Task) EvaluateConditional() bool {
-  res, err := EvaluateConditional(t)
+// fields which are not templated by PostValidate, the conditionals are
+// evaluated as expressions, loops are templated when their items are
+// needed (and the loop_control, which uses the item, for each item)
+// and the vars are templated as they are used
+var task_static_fields = []string{"when", "changed_when", "failed_when", "until", "loop", "loop_control", "register", "tags", "notify", "vars"}
+
+// PostValidate squashes the value each field inherits from its blocks into
+// the task itself and templates them (along with the args), so this
+// should be done on a copy of the task for each host
+func (t *Task) PostValidate(templar *Templar) error {
+  s := reflect.ValueOf(t).Elem()
+  for name, _ := range t.GetAllObjectFieldAttributes() {
+    field := s.FieldByName("Attr_" + name)
+    if field.Kind() == reflect.Invalid {
+      continue
+    }
+    value := t.GetInheritedValue(name)
+    if StringPos(name, task_static_fields) == -1 {
+      templated, err := templar.Template(value)
+      if err != nil {
+        return err
+      }
+      value = templated
+    }
+    if value != nil {
+      field.Set(reflect.ValueOf(value))
+    } else {
+      field.Set(reflect.Zero(field.Type()))
+    }
+  }
+  args, err := templar.Template(t.Args())
   if err != nil {
-    panic(err)
+    return err
   }
-  return res
+  t.Attr_args = args
+  t.squashed = true
+  t.finalized = true
+  t.bindMixins()
+  return nil
+}
+
+func (t *Task) EvaluateTags(only_tags []string, skip_tags []string) bool {
+  return EvaluateTags(t, only_tags, skip_tags)
+}
+
+func (t *Task) EvaluateConditional(templar *Templar) (bool, string, error) {
+  return EvaluateConditional(t, templar)
 }
 
 // local getters
@@ -245,11 +310,18 @@ func (t *Task) FailedWhen() []string {
     return res
   }
 }
-func (t *Task) Loop() []string {
-  if res, ok := t.GetInheritedValue("loop").([]string); ok {
+func (t *Task) Loop() interface{} {
+  return t.GetInheritedValue("loop")
+}
+func (t *Task) LoopControl() *LoopControl {
+  data, _ := inventory.NormalizeValue(t.GetInheritedValue("loop_control")).(map[string]interface{})
+  return NewLoopControl(data)
+}
+func (t *Task) LoopWith() string {
+  if res, ok := t.GetInheritedValue("loop_with").(string); ok {
     return res
   } else {
-    res, _ := task_fields["loop"].Default.([]string)
+    res, _ := task_fields["loop_with"].Default.(string)
     return res
   }
 }
@@ -294,6 +366,21 @@ func (t *Task) Until() []string {
   }
 }
 
+// GetVars returns the vars of this task, merged over those of its blocks
+func (t *Task) GetVars() map[string]interface{} {
+  all_vars := make(map[string]interface{})
+  switch parent := t.parent.(type) {
+  case *Block:
+    all_vars = parent.GetVars()
+  case *Task:
+    all_vars = parent.GetVars()
+  }
+  for k, v := range t.Vars() {
+    all_vars[k] = v
+  }
+  return all_vars
+}
+
 // the generator function for tasks
 func NewTask(data map[interface{}]interface{}, parent Parent) *Task {
   t := new(Task)
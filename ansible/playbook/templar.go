@@ -0,0 +1,300 @@
+package playbook
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+  "strings"
+  "github.com/jimi-c/jinja2"
+  "github.com/smallfish/simpleyaml"
+  "../inventory"
+)
+
+// variables may themselves contain templates, so the result of rendering
+// is rendered again until it no longer changes, up to this many times
+const max_template_depth = 10
+
+var single_expression_re = regexp.MustCompile(`(?s)^\{\{\s*(.*?)\s*\}\}$`)
+var variable_path_re = regexp.MustCompile(`^[A-Za-z_]\w*(\.\w+|\[\d+\])*$`)
+var path_part_re = regexp.MustCompile(`\w+`)
+var expression_re = regexp.MustCompile(`(?s)\{\{(.*?)\}\}`)
+var bound_names_re = regexp.MustCompile(`\{%-?\s*(?:for|set|macro)\s+([\w\s,]+?)\s*(?:\bin\b|=|\()`)
+var string_literal_re = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+var identifier_re = regexp.MustCompile(`[A-Za-z_]\w*`)
+var test_name_re = regexp.MustCompile(`(?:^|\W)is(?:\s+not)?\s*$`)
+// what may follow a variable (and its attributes) which handles
+// the variable being undefined itself
+var defined_test_re = regexp.MustCompile(`^(?:\.\w+|\[[^\]]*\])*\s+is\s+(?:not\s+)?(?:un)?defined\b`)
+var default_filter_re = regexp.MustCompile(`^(?:\.\w+|\[[^\]]*\])*\s*\|\s*(?:default|d)\s*\(`)
+
+// names which may appear in an expression without being variables
+var jinja2_names = map[string]bool{
+  "and": true, "or": true, "not": true, "in": true, "is": true, "if": true, "else": true,
+  "true": true, "false": true, "none": true, "True": true, "False": true, "None": true,
+  "loop": true, "range": true, "lookup": true, "query": true, "q": true,
+}
+
+// UndefinedVariableError is returned when a template
+// uses a variable which is not defined
+type UndefinedVariableError struct {
+  Name string
+}
+
+func (e *UndefinedVariableError) Error() string {
+  return fmt.Sprintf("'%s' is undefined", e.Name)
+}
+
+// Templar renders jinja2 templates against a set of variables, normally
+// the variables for one host and task from the VariableManager
+type Templar struct {
+  Vars map[string]interface{}
+  // when set, using a variable which is not defined is an error,
+  // rather than the variable rendering as an empty string
+  Strict bool
+}
+
+// all of the jinja2 contexts are created here, so that
+// everything we add to them is available to every template
+func (t *Templar) newContext() *jinja2.Context {
+  context := jinja2.NewContext(nil)
+  context.AddVariables(t.Vars)
+  for name, f := range filters {
+    context.AddFilter(name, f)
+  }
+  for name, f := range tests {
+    context.AddTest(name, f)
+  }
+  context.AddFunction("lookup", t.lookupFunction(false))
+  context.AddFunction("query", t.lookupFunction(true))
+  context.AddFunction("q", t.lookupFunction(true))
+  return context
+}
+
+func IsTemplate(data string) bool {
+  return strings.Contains(data, "{{") || strings.Contains(data, "{%") || strings.Contains(data, "{#")
+}
+
+// Template renders every string in the value, recursing into lists and
+// dictionaries. A string which is a single expression, such as
+// "{{ packages }}", keeps the type of its result rather than becoming
+// a string, so that lists and dictionaries can be passed around.
+func (t *Templar) Template(value interface{}) (interface{}, error) {
+  switch v := value.(type) {
+  case string:
+    return t.TemplateString(v)
+  case []string:
+    res := make([]interface{}, len(v))
+    for i, item := range v {
+      templated, err := t.TemplateString(item)
+      if err != nil {
+        return nil, err
+      }
+      res[i] = templated
+    }
+    return res, nil
+  case []interface{}:
+    res := make([]interface{}, len(v))
+    for i, item := range v {
+      templated, err := t.Template(item)
+      if err != nil {
+        return nil, err
+      }
+      res[i] = templated
+    }
+    return res, nil
+  case map[string]interface{}:
+    res := make(map[string]interface{})
+    for k, item := range v {
+      templated, err := t.Template(item)
+      if err != nil {
+        return nil, err
+      }
+      res[k] = templated
+    }
+    return res, nil
+  case map[interface{}]interface{}:
+    return t.Template(inventory.NormalizeValue(v))
+  }
+  return value, nil
+}
+
+func (t *Templar) TemplateString(data string) (interface{}, error) {
+  var res interface{} = data
+  for i := 0; i < max_template_depth; i++ {
+    str_res, ok := res.(string)
+    if !ok || !IsTemplate(str_res) {
+      return res, nil
+    }
+    templated, err := t.templateOnce(str_res)
+    if err != nil {
+      return nil, err
+    }
+    if templated_str, ok := templated.(string); ok && templated_str == str_res {
+      return templated, nil
+    }
+    res = templated
+  }
+  return res, nil
+}
+
+func (t *Templar) templateOnce(data string) (interface{}, error) {
+  if t.Strict {
+    if name := t.findUndefined(data); name != "" {
+      return nil, &UndefinedVariableError{name}
+    }
+  }
+
+  expr := ""
+  if m := single_expression_re.FindStringSubmatch(data); m != nil && !strings.Contains(m[1], "{{") {
+    expr = m[1]
+  }
+  // a single variable is looked up directly, so the value is
+  // returned exactly as it is, with its type intact
+  if variable_path_re.MatchString(expr) {
+    if value, ok := lookupVariable(t.Vars, expr); ok {
+      return value, nil
+    }
+  }
+
+  template := new(jinja2.Template)
+  if err := template.Parse(data); err != nil {
+    return nil, fmt.Errorf("template error while templating string: %s: %s", err, data)
+  }
+  res, err := template.Render(t.newContext())
+  if err != nil {
+    return nil, fmt.Errorf("template error while templating string: %s: %s", err, data)
+  }
+  if expr != "" {
+    return nativeValue(res), nil
+  }
+  return res, nil
+}
+
+// turns the rendered result of a single expression back into a value.
+// As with python's literal_eval in ansible, only lists and dictionaries
+// (their python style repr is also valid YAML) and the True, False and
+// None constants are converted. Anything else is kept as a string, so
+// values such as "0644" or "1.10" are left as they are.
+func nativeValue(res string) interface{} {
+  trimmed := strings.TrimSpace(res)
+  if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+    if data, err := simpleyaml.NewYaml([]byte(trimmed)); err == nil {
+      if list, err := data.Array(); err == nil {
+        return inventory.NormalizeValue(list)
+      }
+      if dict, err := data.Map(); err == nil {
+        return inventory.NormalizeValue(dict)
+      }
+    }
+    return res
+  }
+  switch trimmed {
+  case "True":
+    return true
+  case "False":
+    return false
+  case "None":
+    return nil
+  }
+  return res
+}
+
+// looks up a variable path such as "ansible_facts.eth0.ipv4" or "servers[0]"
+func lookupVariable(vars map[string]interface{}, path string) (interface{}, bool) {
+  var value interface{} = vars
+  for _, part := range path_part_re.FindAllString(path, -1) {
+    switch v := value.(type) {
+    case map[string]interface{}:
+      item, ok := v[part]
+      if !ok {
+        return nil, false
+      }
+      value = item
+    case []interface{}:
+      i, err := strconv.Atoi(part)
+      if err != nil || i < 0 || i >= len(v) {
+        return nil, false
+      }
+      value = v[i]
+    default:
+      return nil, false
+    }
+  }
+  return value, true
+}
+
+// returns the first variable used in an expression of the template
+// which is not defined. This only looks at the variables (not their
+// attributes) used before any filters, and skips any variable which
+// handles being undefined itself, with default() or an "is defined" test.
+func (t *Templar) findUndefined(data string) string {
+  bound := make(map[string]bool)
+  for _, m := range bound_names_re.FindAllStringSubmatch(data, -1) {
+    for _, name := range identifier_re.FindAllString(m[1], -1) {
+      bound[name] = true
+    }
+  }
+  for _, m := range expression_re.FindAllStringSubmatch(data, -1) {
+    full_expr := string_literal_re.ReplaceAllString(m[1], "''")
+    // a variable tested with "is defined" anywhere in the expression
+    // may be used elsewhere in it, as in "x is defined and x > 1"
+    guarded := make(map[string]bool)
+    for _, loc := range identifier_re.FindAllStringIndex(full_expr, -1) {
+      if defined_test_re.MatchString(full_expr[loc[1]:]) {
+        guarded[full_expr[loc[0]:loc[1]]] = true
+      }
+    }
+    expr := full_expr
+    if pos := strings.Index(expr, "|"); pos != -1 {
+      expr = expr[:pos]
+    }
+    for _, loc := range identifier_re.FindAllStringIndex(expr, -1) {
+      name := expr[loc[0]:loc[1]]
+      // attributes, numbers (as in 1e5) and function calls are not variables
+      if loc[0] > 0 && (expr[loc[0]-1] == '.' || (expr[loc[0]-1] >= '0' && expr[loc[0]-1] <= '9')) {
+        continue
+      }
+      rest := strings.TrimSpace(expr[loc[1]:])
+      if strings.HasPrefix(rest, "(") {
+        continue
+      }
+      // nor are keyword arguments, as in lookup('env', 'HOME', errors='ignore')
+      if strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==") &&
+         strings.Count(expr[:loc[0]], "(") > strings.Count(expr[:loc[0]], ")") {
+        continue
+      }
+      // nor are the names of tests, as in "result is failed"
+      if test_name_re.MatchString(expr[:loc[0]]) {
+        continue
+      }
+      if jinja2_names[name] || bound[name] || guarded[name] {
+        continue
+      }
+      // the filters are cut from the expression above, so this
+      // looks at the full expression for a default() filter
+      if default_filter_re.MatchString(full_expr[loc[1]:]) {
+        continue
+      }
+      if _, ok := t.Vars[name]; !ok {
+        return name
+      }
+    }
+  }
+  return ""
+}
+
+// TemplateExpression renders a jinja2 expression (without the surrounding
+// {{ }}) with the given variables, for the constructed inventory sources
+func TemplateExpression(expr string, vars map[string]interface{}) (interface{}, error) {
+  return NewTemplar(vars).TemplateString("{{ " + expr + " }}")
+}
+
+func NewTemplar(vars map[string]interface{}) *Templar {
+  t := new(Templar)
+  t.Vars = vars
+  if t.Vars == nil {
+    t.Vars = make(map[string]interface{})
+  }
+  t.Strict = true
+  return t
+}
@@ -0,0 +1,148 @@
+package playbook
+
+import (
+  "reflect"
+  "testing"
+)
+
+var templar_vars = map[string]interface{}{
+  "name": "world",
+  "count": 3,
+  "version": "1.10",
+  "packages": []interface{}{"a", "b"},
+  "server": map[string]interface{}{
+    "names": []interface{}{"web1", "web2"},
+    "port": 8080,
+  },
+  "nested": "{{ count }}",
+  "greeting": "hello {{ name }}",
+}
+
+func TestTemplate(t *testing.T) {
+  tests := []struct {
+    name string
+    value interface{}
+    want interface{}
+  }{
+    {"plain string", "plain", "plain"},
+    {"not a string", 42, 42},
+    {"single variable keeps its type", "{{ packages }}", []interface{}{"a", "b"}},
+    {"variable path", "{{ server.names[1] }}", "web2"},
+    {"variable path to an int", "{{ server.port }}", 8080},
+    {"text around an expression", "hello {{ name }}!", "hello world!"},
+    {"expression result is a string", "{{ count + 1 }}", "4"},
+    {"zero padded result is kept", "{{ mode | default('0644') }}", "0644"},
+    {"version is not a float", "{{ version ~ '' }}", "1.10"},
+    {"quotes are kept", "{{ '\"x\"' }}", "\"x\""},
+    {"boolean result", "{{ count > 1 }}", true},
+    {"list result", "{{ [1, 'a'] }}", []interface{}{1, "a"}},
+    {"variables are templated again", "{{ nested }}", 3},
+    {"variables with text are templated again", "{{ greeting }}", "hello world"},
+    {"filter", "{{ name | b64encode }}", "d29ybGQ="},
+    {"default of an undefined variable", "{{ missing | default('x') }}", "x"},
+    {
+      "list",
+      []interface{}{"{{ name }}", "b", 1},
+      []interface{}{"world", "b", 1},
+    },
+    {
+      "string list",
+      []string{"{{ name }}", "b"},
+      []interface{}{"world", "b"},
+    },
+    {
+      "map",
+      map[string]interface{}{"a": "{{ count }}", "b": []interface{}{"{{ name }}"}},
+      map[string]interface{}{"a": 3, "b": []interface{}{"world"}},
+    },
+    {
+      "YAML map",
+      map[interface{}]interface{}{"a": "{{ name }}"},
+      map[string]interface{}{"a": "world"},
+    },
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      got, err := NewTemplar(templar_vars).Template(test.value)
+      if err != nil {
+        t.Errorf("unexpected error: %s", err)
+      } else if !reflect.DeepEqual(got, test.want) {
+        t.Errorf("got %#v, want %#v", got, test.want)
+      }
+    })
+  }
+}
+
+func TestTemplateUndefined(t *testing.T) {
+  tests := []struct {
+    value interface{}
+    name string
+  }{
+    {"{{ missing }}", "missing"},
+    {"hello {{ missing }}", "missing"},
+    {"{{ missing.attr }}", "missing"},
+    {[]interface{}{"ok", "{{ missing }}"}, "missing"},
+    {map[string]interface{}{"a": "{{ missing }}"}, "missing"},
+  }
+  for _, test := range tests {
+    _, err := NewTemplar(templar_vars).Template(test.value)
+    if undefined, ok := err.(*UndefinedVariableError); !ok {
+      t.Errorf("Template(%#v): expected an UndefinedVariableError, got %v", test.value, err)
+    } else if undefined.Name != test.name {
+      t.Errorf("Template(%#v): got undefined variable %q, want %q", test.value, undefined.Name, test.name)
+    }
+  }
+
+  // without strict checking undefined variables are empty
+  templar := NewTemplar(templar_vars)
+  templar.Strict = false
+  if got, err := templar.Template("a{{ missing }}b"); err != nil || got != "ab" {
+    t.Errorf("got %#v, %v, want \"ab\"", got, err)
+  }
+}
+
+func TestFindUndefined(t *testing.T) {
+  tests := []struct {
+    data string
+    want string
+  }{
+    {"no template", ""},
+    {"{{ name }}", ""},
+    {"{{ missing }}", "missing"},
+    {"{{ name }} {{ missing }}", "missing"},
+    {"{{ server.missing }}", ""},
+    {"{{ 'missing' }}", ""},
+    {"{{ 1e5 }}", ""},
+    {"{{ name == missing }}", "missing"},
+    {"{{ missing | b64encode }}", "missing"},
+    {"{{ name | default(missing) }}", ""},
+    // variables which handle being undefined themselves
+    {"{{ missing | default('x') }}", ""},
+    {"{{ missing | d('x') }}", ""},
+    {"{{ missing.attr | default('x') }}", ""},
+    {"{{ missing is defined }}", ""},
+    {"{{ missing is not defined }}", ""},
+    {"{{ missing is undefined }}", ""},
+    {"{{ missing is defined and missing > 1 }}", ""},
+    {"{{ count if missing is defined else 0 }}", ""},
+    // only the actual default filter and defined tests are allowed
+    {"{{ defaults_dir }}", "defaults_dir"},
+    {"{{ missing_defined }}", "missing_defined"},
+    {"{{ d(missing) }}", "missing"},
+    {"{{ missing if name is defined else 0 }}", "missing"},
+    // keyword arguments, tests and functions are not variables
+    {"{{ lookup('env', 'HOME', errors='ignore') }}", ""},
+    {"{{ query('items', packages, wantlist=True) }}", ""},
+    {"{{ packages is iterable }}", ""},
+    {"{{ range(3) }}", ""},
+    // variables bound by the template itself
+    {"{% for item in packages %}{{ item }}{% endfor %}", ""},
+    {"{% set x = 1 %}{{ x }}", ""},
+  }
+  templar := NewTemplar(templar_vars)
+  for _, test := range tests {
+    if got := templar.findUndefined(test.data); got != test.want {
+      t.Errorf("findUndefined(%q) = %q, want %q", test.data, got, test.want)
+    }
+  }
+}
@@ -0,0 +1,352 @@
+package playbook
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+  "strings"
+  "../inventory"
+)
+
+// TestFunc is a jinja2 test, as in "result is failed" or "x is
+// version('2.0', '>=')", which is given the value being tested along
+// with the positional and keyword arguments from the template
+type TestFunc func(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error)
+
+// all of the tests available to templates and conditionals, the built-in
+// tests are added here and test plugins are added with RegisterTests
+var tests = make(map[string]TestFunc)
+
+func init() {
+  RegisterTests(map[string]TestFunc{
+    "defined": testDefined,
+    "undefined": testUndefined,
+    "none": testUndefined,
+    "truthy": testTruthy,
+    "falsy": testFalsy,
+    "equalto": testEqualTo,
+    "==": testEqualTo,
+    "eq": testEqualTo,
+    "sameas": testEqualTo,
+    "!=": testNotEqualTo,
+    "ne": testNotEqualTo,
+    "in": testIn,
+    "contains": testContains,
+    "subset": testSubset,
+    "superset": testSuperset,
+    "string": testString,
+    "number": testNumber,
+    "mapping": testMapping,
+    "sequence": testSequence,
+    "iterable": testSequence,
+    "succeeded": testSucceeded,
+    "success": testSucceeded,
+    "successful": testSucceeded,
+    "failed": testFailed,
+    "failure": testFailed,
+    "changed": testChanged,
+    "change": testChanged,
+    "skipped": testSkipped,
+    "skip": testSkipped,
+    "unreachable": testUnreachable,
+    "reachable": testReachable,
+    "match": testMatch,
+    "search": testSearch,
+    "regex": testRegex,
+    "version": testVersion,
+    "version_compare": testVersion,
+  })
+}
+
+// RegisterTests adds tests to every template,
+// replacing any existing tests with the same name
+func RegisterTests(new_tests map[string]TestFunc) {
+  for name, t := range new_tests {
+    tests[name] = t
+  }
+}
+
+// applies a test by name, as select and selectattr do
+func applyTest(name string, value interface{}, args []interface{}) (bool, error) {
+  t, ok := tests[name]
+  if !ok {
+    return false, fmt.Errorf("no test named '%s'", name)
+  }
+  return t(value, args, make(map[string]interface{}))
+}
+
+// an undefined value is nil
+func testDefined(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return value != nil, nil
+}
+
+func testUndefined(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return value == nil, nil
+}
+
+func testTruthy(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return isTrue(value), nil
+}
+
+func testFalsy(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return !isTrue(value), nil
+}
+
+func testEqualTo(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return valuesEqual(value, filterArg(args, kwargs, 0, "other", nil)), nil
+}
+
+func testNotEqualTo(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return !valuesEqual(value, filterArg(args, kwargs, 0, "other", nil)), nil
+}
+
+func contains(container interface{}, value interface{}) bool {
+  if s, ok := container.(string); ok {
+    return strings.Contains(s, pythonString(value))
+  }
+  if m, ok := inventory.NormalizeValue(container).(map[string]interface{}); ok {
+    _, found := m[pythonString(value)]
+    return found
+  }
+  if list, err := toList(container, "in"); err == nil {
+    for _, item := range list {
+      if valuesEqual(value, item) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+func testIn(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return contains(filterArg(args, kwargs, 0, "seq", nil), value), nil
+}
+
+func testContains(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return contains(value, filterArg(args, kwargs, 0, "item", nil)), nil
+}
+
+func testSubset(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  list, err := toList(value, "subset")
+  if err != nil {
+    return false, err
+  }
+  other := filterArg(args, kwargs, 0, "b", nil)
+  for _, item := range list {
+    if !contains(other, item) {
+      return false, nil
+    }
+  }
+  return true, nil
+}
+
+func testSuperset(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return testSubset(filterArg(args, kwargs, 0, "b", nil), []interface{}{value}, nil)
+}
+
+func testString(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  _, ok := value.(string)
+  return ok, nil
+}
+
+func testNumber(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  _, ok := toFloat(value)
+  return ok, nil
+}
+
+func testMapping(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  _, ok := inventory.NormalizeValue(value).(map[string]interface{})
+  return ok, nil
+}
+
+func testSequence(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  switch value.(type) {
+  case string, []interface{}, []string, map[string]interface{}, map[interface{}]interface{}:
+    return true, nil
+  }
+  return false, nil
+}
+
+// the task result tests all need a result, as registered by a task
+func taskResult(value interface{}, test string) (map[string]interface{}, error) {
+  if res, ok := inventory.NormalizeValue(value).(map[string]interface{}); ok {
+    return res, nil
+  }
+  return nil, fmt.Errorf("The %s test expects a dictionary", test)
+}
+
+func resultFlag(res map[string]interface{}, flag string) bool {
+  value, _ := filterBool(res[flag], nil, nil)
+  return value.(bool)
+}
+
+func testFailed(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  res, err := taskResult(value, "failed")
+  if err != nil {
+    return false, err
+  }
+  return resultFlag(res, "failed"), nil
+}
+
+func testSucceeded(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  res, err := taskResult(value, "succeeded")
+  if err != nil {
+    return false, err
+  }
+  return !resultFlag(res, "failed"), nil
+}
+
+// a looped result without its own changed flag
+// has changed if any of its items have
+func testChanged(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  res, err := taskResult(value, "changed")
+  if err != nil {
+    return false, err
+  }
+  if _, ok := res["changed"]; ok {
+    return resultFlag(res, "changed"), nil
+  }
+  if results, ok := res["results"].([]interface{}); ok {
+    for _, item := range results {
+      if item_res, ok := item.(map[string]interface{}); ok && resultFlag(item_res, "changed") {
+        return true, nil
+      }
+    }
+  }
+  return false, nil
+}
+
+func testSkipped(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  res, err := taskResult(value, "skipped")
+  if err != nil {
+    return false, err
+  }
+  return resultFlag(res, "skipped"), nil
+}
+
+func testUnreachable(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  res, err := taskResult(value, "unreachable")
+  if err != nil {
+    return false, err
+  }
+  return resultFlag(res, "unreachable"), nil
+}
+
+func testReachable(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  res, err := taskResult(value, "reachable")
+  if err != nil {
+    return false, err
+  }
+  return !resultFlag(res, "unreachable"), nil
+}
+
+// match(pattern, ignorecase=False, multiline=False) matches at the start
+// of the value (as python's re.match), search matches anywhere in it
+func regexTest(value interface{}, args []interface{}, kwargs map[string]interface{}, match_type string) (bool, error) {
+  pattern := pythonString(filterArg(args, kwargs, 0, "pattern", ""))
+  flags := ""
+  if isTrue(filterArg(args, kwargs, 1, "ignorecase", false)) {
+    flags += "i"
+  }
+  if isTrue(filterArg(args, kwargs, 2, "multiline", false)) {
+    flags += "m"
+  }
+  if match_type == "match" {
+    pattern = `\A(?:` + pattern + `)`
+  }
+  if flags != "" {
+    pattern = "(?" + flags + ")" + pattern
+  }
+  re, err := regexp.Compile(pattern)
+  if err != nil {
+    return false, fmt.Errorf("%s: invalid pattern: %s", match_type, err)
+  }
+  return re.MatchString(pythonString(value)), nil
+}
+
+func testMatch(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return regexTest(value, args, kwargs, "match")
+}
+
+func testSearch(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  return regexTest(value, args, kwargs, "search")
+}
+
+// regex(pattern, ignorecase=False, multiline=False, match_type='search')
+func testRegex(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  match_type := pythonString(filterArg(args, kwargs, 3, "match_type", "search"))
+  if match_type != "match" && match_type != "search" {
+    return false, fmt.Errorf("regex: match_type must be match or search, not %s", match_type)
+  }
+  return regexTest(value, args, kwargs, match_type)
+}
+
+var version_part_re = regexp.MustCompile(`\d+|[a-zA-Z]+`)
+
+// compares versions as python's LooseVersion does, so "1.10" is
+// newer than "1.9", returning -1, 0 or 1 as a is older, the same
+// as or newer than b
+func compareVersions(a string, b string) int {
+  a_parts := version_part_re.FindAllString(a, -1)
+  b_parts := version_part_re.FindAllString(b, -1)
+  for i := 0; i < len(a_parts) && i < len(b_parts); i++ {
+    a_num, a_err := strconv.Atoi(a_parts[i])
+    b_num, b_err := strconv.Atoi(b_parts[i])
+    if a_err == nil && b_err == nil {
+      if a_num != b_num {
+        if a_num < b_num {
+          return -1
+        }
+        return 1
+      }
+    } else if a_parts[i] != b_parts[i] {
+      if a_parts[i] < b_parts[i] {
+        return -1
+      }
+      return 1
+    }
+  }
+  switch {
+  case len(a_parts) < len(b_parts):
+    return -1
+  case len(a_parts) > len(b_parts):
+    return 1
+  }
+  return 0
+}
+
+var strict_version_re = regexp.MustCompile(`^\d+\.\d+(\.\d+)?([ab]\d+)?$`)
+
+// version(version, operator='eq', strict=False)
+func testVersion(value interface{}, args []interface{}, kwargs map[string]interface{}) (bool, error) {
+  version := pythonString(filterArg(args, kwargs, 0, "version", ""))
+  operator := pythonString(filterArg(args, kwargs, 1, "operator", "eq"))
+  strict := isTrue(filterArg(args, kwargs, 2, "strict", false))
+  current := pythonString(value)
+  if version == "" {
+    return false, fmt.Errorf("Version parameter to compare against cannot be empty")
+  }
+  if strict {
+    for _, v := range []string{current, version} {
+      if !strict_version_re.MatchString(v) {
+        return false, fmt.Errorf("Version comparison: invalid version number '%s'", v)
+      }
+    }
+  }
+  res := compareVersions(current, version)
+  switch operator {
+  case "==", "=", "eq":
+    return res == 0, nil
+  case "!=", "<>", "ne":
+    return res != 0, nil
+  case "<", "lt":
+    return res < 0, nil
+  case "<=", "le":
+    return res <= 0, nil
+  case ">", "gt":
+    return res > 0, nil
+  case ">=", "ge":
+    return res >= 0, nil
+  }
+  return false, fmt.Errorf("Invalid operator type (%s)", operator)
+}
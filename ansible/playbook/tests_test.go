@@ -0,0 +1,148 @@
+package playbook
+
+import (
+  "strings"
+  "testing"
+)
+
+type jinjaTest struct {
+  test string
+  value interface{}
+  args []interface{}
+  kwargs map[string]interface{}
+  want bool
+  err string
+}
+
+var ok_result = map[string]interface{}{"changed": false, "failed": false}
+var changed_result = map[string]interface{}{"changed": true}
+var failed_result = map[string]interface{}{"failed": true, "msg": "oops"}
+var skipped_result = map[string]interface{}{"skipped": true, "changed": false}
+var unreachable_result = map[string]interface{}{"unreachable": true}
+var looped_result = map[string]interface{}{
+  "results": []interface{}{
+    map[string]interface{}{"changed": false},
+    map[string]interface{}{"changed": true},
+  },
+}
+
+var jinja_tests = []jinjaTest{
+  // defined and undefined, where an undefined value is nil
+  {test: "defined", value: "x", want: true},
+  {test: "defined", value: false, want: true},
+  {test: "defined", value: nil, want: false},
+  {test: "undefined", value: nil, want: true},
+  {test: "none", value: 1, want: false},
+
+  // truthiness and comparisons
+  {test: "truthy", value: "x", want: true},
+  {test: "truthy", value: []interface{}{}, want: false},
+  {test: "falsy", value: 0, want: true},
+  {test: "equalto", value: 1, args: []interface{}{1.0}, want: true},
+  {test: "==", value: "a", args: []interface{}{"b"}, want: false},
+  {test: "!=", value: "a", args: []interface{}{"b"}, want: true},
+  {test: "in", value: "b", args: []interface{}{[]interface{}{"a", "b"}}, want: true},
+  {test: "in", value: "ell", args: []interface{}{"hello"}, want: true},
+  {test: "in", value: "k", args: []interface{}{map[string]interface{}{"k": 1}}, want: true},
+  {test: "contains", value: []interface{}{1, 2}, args: []interface{}{3}, want: false},
+  {test: "subset", value: []interface{}{1, 2}, args: []interface{}{[]interface{}{1, 2, 3}}, want: true},
+  {test: "subset", value: []interface{}{1, 4}, args: []interface{}{[]interface{}{1, 2, 3}}, want: false},
+  {test: "superset", value: []interface{}{1, 2, 3}, args: []interface{}{[]interface{}{1, 2}}, want: true},
+  {test: "superset", value: []interface{}{1}, args: []interface{}{[]interface{}{1, 2}}, want: false},
+
+  // types
+  {test: "string", value: "x", want: true},
+  {test: "string", value: 1, want: false},
+  {test: "number", value: 1.5, want: true},
+  {test: "number", value: "1", want: false},
+  {test: "mapping", value: map[interface{}]interface{}{"a": 1}, want: true},
+  {test: "mapping", value: []interface{}{}, want: false},
+  {test: "sequence", value: []interface{}{}, want: true},
+  {test: "iterable", value: 1, want: false},
+
+  // task results
+  {test: "succeeded", value: ok_result, want: true},
+  {test: "success", value: failed_result, want: false},
+  {test: "failed", value: failed_result, want: true},
+  {test: "failed", value: ok_result, want: false},
+  {test: "failed", value: map[string]interface{}{"failed": "yes"}, want: true},
+  {test: "failed", value: "text", err: "The failed test expects a dictionary"},
+  {test: "changed", value: changed_result, want: true},
+  {test: "changed", value: ok_result, want: false},
+  {test: "changed", value: looped_result, want: true},
+  {test: "change", value: map[string]interface{}{}, want: false},
+  {test: "skipped", value: skipped_result, want: true},
+  {test: "skipped", value: ok_result, want: false},
+  {test: "unreachable", value: unreachable_result, want: true},
+  {test: "reachable", value: unreachable_result, want: false},
+  {test: "reachable", value: ok_result, want: true},
+
+  // regular expressions
+  {test: "match", value: "web01", args: []interface{}{"web"}, want: true},
+  {test: "match", value: "myweb01", args: []interface{}{"web"}, want: false},
+  {test: "match", value: "a|web", args: []interface{}{"b|a"}, want: true},
+  {test: "match", value: "WEB01", args: []interface{}{"web"}, kwargs: map[string]interface{}{"ignorecase": true}, want: true},
+  {test: "search", value: "myweb01", args: []interface{}{"web"}, want: true},
+  {test: "search", value: "a\nweb", args: []interface{}{"^web"}, want: false},
+  {test: "search", value: "a\nweb", args: []interface{}{"^web"}, kwargs: map[string]interface{}{"multiline": true}, want: true},
+  {test: "regex", value: "myweb01", args: []interface{}{"web"}, want: true},
+  {test: "regex", value: "myweb01", args: []interface{}{"web"}, kwargs: map[string]interface{}{"match_type": "match"}, want: false},
+  {test: "regex", value: "x", args: []interface{}{"x"}, kwargs: map[string]interface{}{"match_type": "full"}, err: "match_type must be match or search"},
+  {test: "match", value: "x", args: []interface{}{"("}, err: "invalid pattern"},
+
+  // versions
+  {test: "version", value: "1.10", args: []interface{}{"1.9", ">"}, want: true},
+  {test: "version", value: "1.2.0", args: []interface{}{"1.2"}, want: false},
+  {test: "version", value: "1.2", args: []interface{}{"1.2", "eq"}, want: true},
+  {test: "version", value: "2.0", args: []interface{}{"2.0.1", "lt"}, want: true},
+  {test: "version", value: "1.0a1", args: []interface{}{"1.0b1", "<"}, want: true},
+  {test: "version_compare", value: "2.5", args: []interface{}{"2.4", "ge"}, want: true},
+  {test: "version", value: "1.2.3", args: []interface{}{"1.2.3"}, kwargs: map[string]interface{}{"strict": true}, want: true},
+  {test: "version", value: "1.2-beta", args: []interface{}{"1.2"}, kwargs: map[string]interface{}{"strict": true}, err: "invalid version number '1.2-beta'"},
+  {test: "version", value: "1.2", args: []interface{}{""}, err: "cannot be empty"},
+  {test: "version", value: "1.2", args: []interface{}{"1.2", "~="}, err: "Invalid operator type (~=)"},
+}
+
+func TestTests(t *testing.T) {
+  for _, test := range jinja_tests {
+    f, ok := tests[test.test]
+    if !ok {
+      t.Errorf("no test named '%s'", test.test)
+      continue
+    }
+    kwargs := test.kwargs
+    if kwargs == nil {
+      kwargs = make(map[string]interface{})
+    }
+    got, err := f(test.value, test.args, kwargs)
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("%#v is %s(%v, %v): expected an error containing %q, got %v", test.value, test.test, test.args, test.kwargs, test.err, err)
+      }
+    } else if err != nil {
+      t.Errorf("%#v is %s(%v, %v): unexpected error: %s", test.value, test.test, test.args, test.kwargs, err)
+    } else if got != test.want {
+      t.Errorf("%#v is %s(%v, %v) = %v, want %v", test.value, test.test, test.args, test.kwargs, got, test.want)
+    }
+  }
+}
+
+func TestCompareVersions(t *testing.T) {
+  tests := []struct {
+    a string
+    b string
+    want int
+  }{
+    {"1.0", "1.0", 0},
+    {"1.9", "1.10", -1},
+    {"2.0", "1.99", 1},
+    {"1.0", "1.0.1", -1},
+    {"1.0b1", "1.0a2", 1},
+    {"1.0", "1.0a", -1},
+  }
+  for _, test := range tests {
+    if got := compareVersions(test.a, test.b); got != test.want {
+      t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+    }
+  }
+}
@@ -4,6 +4,7 @@ import (
   "os"
   "path/filepath"
   "strings"
+  "../inventory"
 )
 
 type ModuleInfo struct {
@@ -209,28 +210,72 @@ func Unquote(data string) string {
   return data
 }
 
-func ExtendValue(cur_value []interface{}, new_value []interface{}, prepend bool) []interface{} {
-  new_list := make([]interface{}, len(cur_value) + len(new_value))
-  var one []interface{} = nil
-  var two []interface{} = nil
-  if prepend {
-    one = new_value
-    two = cur_value
-  } else {
-    one = cur_value
-    two = new_value
+// ExtendValue combines the value of a field with the value from its parent.
+// Lists are joined (with the parent's value first when prepend is set) and
+// dictionaries are merged, with the values from cur_value winning.
+func ExtendValue(cur_value interface{}, new_value interface{}, prepend bool) interface{} {
+  if cur_map, ok := inventory.NormalizeValue(cur_value).(map[string]interface{}); ok {
+    new_map, ok := inventory.NormalizeValue(new_value).(map[string]interface{})
+    if !ok {
+      return cur_map
+    }
+    res := make(map[string]interface{})
+    for k, v := range new_map {
+      res[k] = v
+    }
+    for k, v := range cur_map {
+      res[k] = v
+    }
+    return res
   }
-  last_i := 0
-  for i, v := range one {
-    new_list[i] = v
-    last_i = i
+
+  one := toInterfaceList(cur_value)
+  two := toInterfaceList(new_value)
+  if prepend {
+    one, two = two, one
   }
-  for i, v := range two {
-    new_list[last_i + i] = v
+  new_list := make([]interface{}, 0, len(one) + len(two))
+  new_list = append(new_list, one...)
+  new_list = append(new_list, two...)
+
+  // keep lists of strings as they were loaded, since that
+  // is what the getters for those fields expect
+  if _, ok := cur_value.([]string); ok {
+    if str_list, ok := toStringList(new_list); ok {
+      return str_list
+    }
   }
   return new_list
 }
 
+func toInterfaceList(value interface{}) []interface{} {
+  switch v := value.(type) {
+  case []interface{}:
+    return v
+  case []string:
+    res := make([]interface{}, len(v))
+    for i, item := range v {
+      res[i] = item
+    }
+    return res
+  case nil:
+    return []interface{}{}
+  }
+  return []interface{}{value}
+}
+
+func toStringList(list []interface{}) ([]string, bool) {
+  res := make([]string, len(list))
+  for i, item := range list {
+    str_item, ok := item.(string)
+    if !ok {
+      return nil, false
+    }
+    res[i] = str_item
+  }
+  return res, true
+}
+
 func TypeOf(v interface{}) string {
     switch t := v.(type) {
     case int:
@@ -18,3 +18,8 @@ func (c *ConnectionPluginBase) Initialize(host inventory.Host, task playbook.Tas
   c.PlayContext = pc
   c.Connected = false
 }
+
+// Reset closes any connection which is kept open between tasks, so that
+// the next task connects again. Most connections are not kept open.
+func (c *ConnectionPluginBase) Reset() {
+}
@@ -23,6 +23,16 @@ func (c *ConnectionPlugin) Close() {
   c.Connected = false
 }
 
+// stops the persistent master connection, if there is one
+func (c *ConnectionPlugin) Reset() {
+  ssh_executable := c.PlayContext.SSH_executable()
+  the_cmd := BuildCommand(ssh_executable, []string{"-O", "stop", c.Host.Name})
+  fmt.Println("SSH COMMAND:", the_cmd)
+  // the master connection may have already exited
+  exec.Command(the_cmd[0], the_cmd[1:]...).Run()
+  c.Connected = false
+}
+
 func (c *ConnectionPlugin) Execute(cmd []string, in_data string) (int, string, string) {
   ssh_executable := c.PlayContext.SSH_executable()
 
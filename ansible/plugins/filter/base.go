@@ -0,0 +1,14 @@
+package filter
+
+import (
+  "../../playbook"
+)
+
+type FilterPluginBase struct {
+}
+
+// plugins override this to return their filters, keyed by the
+// name they are used with in templates
+func (f *FilterPluginBase) Filters() map[string]playbook.FilterFunc {
+  return make(map[string]playbook.FilterFunc)
+}
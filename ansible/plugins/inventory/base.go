@@ -0,0 +1,20 @@
+package inventory
+
+import (
+  "os"
+  "../../inventory"
+)
+
+type InventoryPluginBase struct {
+}
+
+// by default any regular file is accepted, plugins should
+// override this with a check specific to their sources
+func (i *InventoryPluginBase) Verify(path string) bool {
+  info, err := os.Stat(path)
+  return err == nil && info.Mode().IsRegular()
+}
+
+func (i *InventoryPluginBase) Parse(path string, im *inventory.InventoryManager) error {
+  return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+  "os"
+  "strings"
+  "../../../inventory"
+  inventory_base "../../../plugins/inventory"
+)
+
+// parses a comma separated list of hosts given directly as the
+// source, as in "-i host1,host2:2222" or "-i localhost,"
+type InventoryPlugin struct {
+  inventory_base.InventoryPluginBase
+}
+
+func (i *InventoryPlugin) Verify(path string) bool {
+  if _, err := os.Stat(path); err == nil {
+    return false
+  }
+  return strings.Contains(path, ",")
+}
+
+func (i *InventoryPlugin) Parse(path string, im *inventory.InventoryManager) error {
+  for _, h := range strings.Split(path, ",") {
+    h = strings.TrimSpace(h)
+    if h == "" {
+      continue
+    }
+    if _, err := im.AddHostPattern(h, "ungrouped"); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// All inventory plugins must define this line, it is the entry point
+var Inventory InventoryPlugin
@@ -0,0 +1,226 @@
+package main
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "../../../inventory"
+  inventory_base "../../../plugins/inventory"
+)
+
+// the same limit ssh puts on nested Include directives
+const max_include_depth = 16
+
+// the ssh options we turn into connection variables
+var ssh_option_vars = map[string]string {
+  "hostname": "ansible_host",
+  "port": "ansible_port",
+  "user": "ansible_user",
+  "identityfile": "ansible_ssh_private_key_file",
+}
+
+// a Host (or Match) block, options given before the
+// first block apply to every host, as if under "Host *"
+type sshConfigBlock struct {
+  patterns []string
+  // Match blocks depend on things we cannot know here, so they never apply
+  match bool
+  options [][2]string
+}
+
+func (b *sshConfigBlock) matches(host string) bool {
+  if b.match {
+    return false
+  }
+  matched := false
+  for _, pattern := range b.patterns {
+    negated := strings.HasPrefix(pattern, "!")
+    if ok, _ := filepath.Match(strings.ToLower(strings.TrimPrefix(pattern, "!")), strings.ToLower(host)); ok {
+      if negated {
+        return false
+      }
+      matched = true
+    }
+  }
+  return matched
+}
+
+// reads hosts from an OpenSSH client config such as ~/.ssh/config. Every
+// literal alias on a Host line becomes a host, while patterns with
+// wildcards or negations are skipped. As with ssh, the first value found
+// for an option wins, so a trailing "Host *" block supplies defaults.
+type InventoryPlugin struct {
+  inventory_base.InventoryPluginBase
+}
+
+func (i *InventoryPlugin) Verify(path string) bool {
+  info, err := os.Stat(path)
+  if err != nil || !info.Mode().IsRegular() {
+    return false
+  }
+  name := filepath.Base(path)
+  if name == "ssh_config" {
+    return true
+  }
+  abs, err := filepath.Abs(path)
+  return err == nil && name == "config" && filepath.Base(filepath.Dir(abs)) == ".ssh"
+}
+
+func (i *InventoryPlugin) Parse(path string, im *inventory.InventoryManager) error {
+  global := &sshConfigBlock{patterns: []string{"*"}}
+  blocks := []*sshConfigBlock{global}
+  if err := parseSshConfig(path, filepath.Dir(path), &blocks, 0); err != nil {
+    return err
+  }
+
+  for _, name := range literalHosts(blocks) {
+    host := im.AddHost(name, "")
+    found := make(map[string]bool)
+    for _, block := range blocks {
+      if !block.matches(name) {
+        continue
+      }
+      for _, option := range block.options {
+        key := option[0]
+        variable, ok := ssh_option_vars[key]
+        if !ok || found[key] {
+          continue
+        }
+        found[key] = true
+        switch key {
+        case "hostname":
+          host.SetVariable(variable, strings.Replace(option[1], "%h", name, -1))
+        case "port":
+          port, err := strconv.Atoi(option[1])
+          if err != nil {
+            return fmt.Errorf("%s: Invalid port for host %s: %s", path, name, option[1])
+          }
+          host.SetVariable(variable, port)
+        default:
+          host.SetVariable(variable, option[1])
+        }
+      }
+    }
+  }
+  return nil
+}
+
+// the aliases which are not patterns, in the order they first appear
+func literalHosts(blocks []*sshConfigBlock) []string {
+  hosts := make([]string, 0)
+  seen := make(map[string]bool)
+  for _, block := range blocks[1:] {
+    if block.match {
+      continue
+    }
+    for _, pattern := range block.patterns {
+      if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+        continue
+      }
+      seen[pattern] = true
+      hosts = append(hosts, pattern)
+    }
+  }
+  return hosts
+}
+
+// parses one config file, appending its blocks. Relative Include paths
+// are relative to basedir, which is the directory of the top level file.
+func parseSshConfig(path string, basedir string, blocks *[]*sshConfigBlock, depth int) error {
+  if depth > max_include_depth {
+    return fmt.Errorf("%s: Maximum include depth exceeded", path)
+  }
+  f, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  lineno := 0
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    lineno += 1
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || line[0] == '#' {
+      continue
+    }
+    keyword, args, err := splitSshConfigLine(line)
+    if err != nil {
+      return fmt.Errorf("%s:%d: %s", path, lineno, err)
+    }
+    if len(args) == 0 {
+      return fmt.Errorf("%s:%d: Missing argument for %s", path, lineno, keyword)
+    }
+
+    current := (*blocks)[len(*blocks)-1]
+    switch keyword {
+    case "host":
+      *blocks = append(*blocks, &sshConfigBlock{patterns: args})
+    case "match":
+      *blocks = append(*blocks, &sshConfigBlock{match: true})
+    case "include":
+      for _, pattern := range args {
+        if strings.HasPrefix(pattern, "~/") {
+          pattern = filepath.Join(os.Getenv("HOME"), pattern[2:])
+        } else if !filepath.IsAbs(pattern) {
+          pattern = filepath.Join(basedir, pattern)
+        }
+        files, err := filepath.Glob(pattern)
+        if err != nil {
+          return fmt.Errorf("%s:%d: Invalid Include pattern %s", path, lineno, pattern)
+        }
+        for _, file := range files {
+          if err := parseSshConfig(file, basedir, blocks, depth + 1); err != nil {
+            return err
+          }
+        }
+      }
+      // the rest of this block still applies to the same hosts
+      if (*blocks)[len(*blocks)-1] != current {
+        *blocks = append(*blocks, &sshConfigBlock{patterns: current.patterns, match: current.match})
+      }
+    default:
+      current.options = append(current.options, [2]string{keyword, args[0]})
+    }
+  }
+  return scanner.Err()
+}
+
+// splits a line into the (lower cased) keyword and its arguments. The
+// keyword may be separated from the arguments with an "=", and arguments
+// may be quoted to include spaces.
+func splitSshConfigLine(line string) (string, []string, error) {
+  tokens, err := inventory.SplitIniLine(line)
+  if err != nil {
+    return "", nil, err
+  }
+  if len(tokens) == 0 {
+    return "", nil, fmt.Errorf("Invalid line: %s", line)
+  }
+  keyword := tokens[0]
+  args := tokens[1:]
+  if pos := strings.Index(keyword, "="); pos != -1 {
+    if rest := keyword[pos+1:]; rest != "" {
+      args = append([]string{rest}, args...)
+    }
+    keyword = keyword[:pos]
+  } else if len(args) > 0 && strings.HasPrefix(args[0], "=") {
+    if rest := args[0][1:]; rest != "" {
+      args[0] = rest
+    } else {
+      args = args[1:]
+    }
+  }
+  for i, arg := range args {
+    if len(arg) > 1 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+      args[i] = arg[1:len(arg)-1]
+    }
+  }
+  return strings.ToLower(keyword), args, nil
+}
+
+// All inventory plugins must define this line, it is the entry point
+var Inventory InventoryPlugin
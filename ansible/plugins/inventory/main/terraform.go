@@ -0,0 +1,285 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+  "../../../inventory"
+  inventory_base "../../../plugins/inventory"
+)
+
+// where the host name, address and tags are found in the attributes
+// of each type of compute resource. Attribute paths may go into nested
+// blocks with dots, as in "network_interface.0.network_ip"
+type computeResource struct {
+  name_attrs []string
+  ip_attrs []string
+  tag_attrs []string
+}
+
+var compute_resources = map[string]computeResource {
+  "aws_instance": computeResource{
+    name_attrs: []string{"tags.Name", "id"},
+    ip_attrs: []string{"public_ip", "private_ip"},
+    tag_attrs: []string{"tags"},
+  },
+  "google_compute_instance": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"network_interface.0.access_config.0.nat_ip", "network_interface.0.network_ip"},
+    tag_attrs: []string{"labels", "tags"},
+  },
+  "azurerm_linux_virtual_machine": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"public_ip_address", "private_ip_address"},
+    tag_attrs: []string{"tags"},
+  },
+  "azurerm_windows_virtual_machine": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"public_ip_address", "private_ip_address"},
+    tag_attrs: []string{"tags"},
+  },
+  "digitalocean_droplet": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"ipv4_address", "ipv4_address_private"},
+    tag_attrs: []string{"tags"},
+  },
+  "hcloud_server": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"ipv4_address"},
+    tag_attrs: []string{"labels"},
+  },
+  "openstack_compute_instance_v2": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"access_ip_v4"},
+    tag_attrs: []string{"metadata", "tags"},
+  },
+  "vsphere_virtual_machine": computeResource{
+    name_attrs: []string{"name"},
+    ip_attrs: []string{"default_ip_address"},
+    tag_attrs: []string{},
+  },
+}
+
+// a single instance of a resource, which is the same for
+// every version of the state format once it is loaded
+type tfInstance struct {
+  resource_type string
+  address string
+  attributes map[string]interface{}
+}
+
+// reads the hosts from a local terraform state file. Each compute
+// resource instance becomes a host named after the instance (or its id),
+// with the IP address as ansible_host. Hosts are put in a group named
+// after the resource type and a "tag_<key>_<value>" group per tag or label.
+type InventoryPlugin struct {
+  inventory_base.InventoryPluginBase
+}
+
+func (i *InventoryPlugin) Verify(path string) bool {
+  info, err := os.Stat(path)
+  return err == nil && info.Mode().IsRegular() && strings.HasSuffix(path, ".tfstate")
+}
+
+func (i *InventoryPlugin) Parse(path string, im *inventory.InventoryManager) error {
+  data, err := ioutil.ReadFile(path)
+  if err != nil {
+    return err
+  }
+  var state map[string]interface{}
+  if err := json.Unmarshal(data, &state); err != nil {
+    return fmt.Errorf("%s: Invalid terraform state: %s", path, err)
+  }
+
+  var instances []tfInstance
+  // version 4 (terraform 0.12 and later) has a flat list of resources,
+  // older versions nest them under the modules and flatten the attributes
+  if _, ok := state["resources"]; ok {
+    instances, err = loadStateV4(state)
+  } else if _, ok := state["modules"]; ok {
+    instances, err = loadStateV3(state)
+  } else {
+    err = fmt.Errorf("no resources found")
+  }
+  if err != nil {
+    return fmt.Errorf("%s: Invalid terraform state: %s", path, err)
+  }
+
+  for _, instance := range instances {
+    resource, ok := compute_resources[instance.resource_type]
+    if !ok {
+      continue
+    }
+    name := firstAttribute(instance.attributes, resource.name_attrs)
+    if name == "" {
+      continue
+    }
+    host := im.AddHost(name, inventory.SafeGroupName(instance.resource_type))
+    host.SetVariable("terraform_resource", instance.address)
+    if ip := firstAttribute(instance.attributes, resource.ip_attrs); ip != "" {
+      host.SetVariable("ansible_host", ip)
+    }
+    for _, attr := range resource.tag_attrs {
+      for _, group := range tagGroups(lookupAttribute(instance.attributes, attr)) {
+        im.AddHost(name, group)
+      }
+    }
+  }
+  return nil
+}
+
+func loadStateV4(state map[string]interface{}) ([]tfInstance, error) {
+  resources, ok := state["resources"].([]interface{})
+  if !ok {
+    return nil, fmt.Errorf("resources must be a list")
+  }
+  instances := make([]tfInstance, 0)
+  for _, r := range resources {
+    resource, ok := r.(map[string]interface{})
+    if !ok {
+      return nil, fmt.Errorf("each resource must be a dictionary")
+    }
+    if mode, _ := resource["mode"].(string); mode != "managed" {
+      continue
+    }
+    resource_type, _ := resource["type"].(string)
+    address := fmt.Sprintf("%s.%v", resource_type, resource["name"])
+    if module, ok := resource["module"].(string); ok {
+      address = module + "." + address
+    }
+    resource_instances, _ := resource["instances"].([]interface{})
+    for _, ri := range resource_instances {
+      instance, _ := ri.(map[string]interface{})
+      attributes, ok := instance["attributes"].(map[string]interface{})
+      if !ok {
+        continue
+      }
+      instance_address := address
+      switch key := instance["index_key"].(type) {
+      case string:
+        instance_address += fmt.Sprintf("[%q]", key)
+      case float64:
+        instance_address += fmt.Sprintf("[%d]", int(key))
+      }
+      instances = append(instances, tfInstance{resource_type, instance_address, attributes})
+    }
+  }
+  return instances, nil
+}
+
+func loadStateV3(state map[string]interface{}) ([]tfInstance, error) {
+  modules, ok := state["modules"].([]interface{})
+  if !ok {
+    return nil, fmt.Errorf("modules must be a list")
+  }
+  instances := make([]tfInstance, 0)
+  for _, m := range modules {
+    module, _ := m.(map[string]interface{})
+    resources, _ := module["resources"].(map[string]interface{})
+    addresses := make([]string, 0, len(resources))
+    for address, _ := range resources {
+      addresses = append(addresses, address)
+    }
+    sort.Strings(addresses)
+    for _, address := range addresses {
+      resource, _ := resources[address].(map[string]interface{})
+      resource_type, _ := resource["type"].(string)
+      primary, _ := resource["primary"].(map[string]interface{})
+      flat, ok := primary["attributes"].(map[string]interface{})
+      if !ok || strings.HasPrefix(address, "data.") {
+        continue
+      }
+      instances = append(instances, tfInstance{resource_type, address, unflattenAttributes(flat)})
+    }
+  }
+  return instances, nil
+}
+
+// the old state format stores nested values as "tags.Name" or
+// "network_interface.0.network_ip" keys, with "tags.%" and
+// "network_interface.#" holding the counts. The nested lists are
+// left as dictionaries keyed by index, which lookupAttribute handles.
+func unflattenAttributes(flat map[string]interface{}) map[string]interface{} {
+  attributes := make(map[string]interface{})
+  for key, value := range flat {
+    parts := strings.Split(key, ".")
+    if last := parts[len(parts)-1]; last == "%" || last == "#" {
+      continue
+    }
+    current := attributes
+    for _, part := range parts[:len(parts)-1] {
+      next, ok := current[part].(map[string]interface{})
+      if !ok {
+        next = make(map[string]interface{})
+        current[part] = next
+      }
+      current = next
+    }
+    current[parts[len(parts)-1]] = value
+  }
+  return attributes
+}
+
+func lookupAttribute(attributes map[string]interface{}, path string) interface{} {
+  var value interface{} = attributes
+  for _, part := range strings.Split(path, ".") {
+    switch v := value.(type) {
+    case map[string]interface{}:
+      value = v[part]
+    case []interface{}:
+      index, err := strconv.Atoi(part)
+      if err != nil || index >= len(v) {
+        return nil
+      }
+      value = v[index]
+    default:
+      return nil
+    }
+  }
+  return value
+}
+
+// returns the first of the attributes which has a (non-empty) value
+func firstAttribute(attributes map[string]interface{}, paths []string) string {
+  for _, path := range paths {
+    switch v := lookupAttribute(attributes, path).(type) {
+    case string:
+      if v != "" {
+        return v
+      }
+    case nil, map[string]interface{}, []interface{}:
+    default:
+      return fmt.Sprintf("%v", v)
+    }
+  }
+  return ""
+}
+
+// tags given as a dictionary give "tag_<key>_<value>" groups, and
+// those given as a list of names give "tag_<name>" groups
+func tagGroups(tags interface{}) []string {
+  groups := make([]string, 0)
+  switch t := tags.(type) {
+  case map[string]interface{}:
+    keys := make([]string, 0, len(t))
+    for k, _ := range t {
+      keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+      groups = append(groups, inventory.SafeGroupName(fmt.Sprintf("tag_%s_%v", k, t[k])))
+    }
+  case []interface{}:
+    for _, tag := range t {
+      groups = append(groups, inventory.SafeGroupName(fmt.Sprintf("tag_%v", tag)))
+    }
+  }
+  return groups
+}
+
+// All inventory plugins must define this line, it is the entry point
+var Inventory InventoryPlugin
@@ -0,0 +1,14 @@
+package lookup
+
+import (
+  "../../playbook"
+)
+
+type LookupPluginBase struct {
+}
+
+// plugins override this to return the values for the terms, relative
+// paths in the terms should be found with templar.FindFile
+func (l *LookupPluginBase) Run(terms []interface{}, kwargs map[string]interface{}, templar *playbook.Templar) ([]interface{}, error) {
+  return make([]interface{}, 0), nil
+}
@@ -2,6 +2,7 @@ package plugins
 
 import (
   "os"
+  "path/filepath"
   "plugin"
   "strings"
   "../inventory"
@@ -51,6 +52,7 @@ type ConnectionInterface interface {
   Initialize(inventory.Host, playbook.Task, playbook.PlayContext)
   Connect()
   Close()
+  Reset()
   Execute([]string, string) (int, string, string)
   PutFile(string, string)
   GetFile(string, string)
@@ -66,3 +68,67 @@ type StrategyInterface interface {
 func LoadStrategyPlugin(name string) StrategyInterface {
   return LoadPlugin(name, "strategy").(StrategyInterface)
 }
+
+// inventory plugins must satisfy inventory.InventoryPlugin, which lives in
+// the inventory package so that the InventoryManager can call them
+func LoadInventoryPlugin(name string) inventory.InventoryPlugin {
+  if !PluginExists(name, "inventory") {
+    return nil
+  }
+  return LoadPlugin(name, "inventory").(inventory.InventoryPlugin)
+}
+
+// a filter plugin provides any number of filters, as a map of their names
+type FilterInterface interface {
+  Filters() map[string]playbook.FilterFunc
+}
+
+func LoadFilterPlugin(name string) FilterInterface {
+  return LoadPlugin(name, "filter").(FilterInterface)
+}
+
+// any template may use any filter, so every filter plugin is loaded
+// up front and its filters added to those built in to the templar
+func LoadFilterPlugins() {
+  mod_names, _ := filepath.Glob(GetExecutableDir() + "/plugins/filter/*.so")
+  for _, mod_name := range mod_names {
+    name := strings.TrimSuffix(filepath.Base(mod_name), ".so")
+    playbook.RegisterFilters(LoadFilterPlugin(name).Filters())
+  }
+}
+
+// test plugins work as filter plugins do, each providing any number of
+// tests (as used in "result is failed"), as a map of their names
+type TestInterface interface {
+  Tests() map[string]playbook.TestFunc
+}
+
+func LoadTestPlugin(name string) TestInterface {
+  return LoadPlugin(name, "test").(TestInterface)
+}
+
+func LoadTestPlugins() {
+  mod_names, _ := filepath.Glob(GetExecutableDir() + "/plugins/test/*.so")
+  for _, mod_name := range mod_names {
+    name := strings.TrimSuffix(filepath.Base(mod_name), ".so")
+    playbook.RegisterTests(LoadTestPlugin(name).Tests())
+  }
+}
+
+// a lookup plugin provides the lookup of the same name, which is given
+// the templar of the task for its variables and search path
+type LookupInterface interface {
+  Run(terms []interface{}, kwargs map[string]interface{}, templar *playbook.Templar) ([]interface{}, error)
+}
+
+func LoadLookupPlugin(name string) LookupInterface {
+  return LoadPlugin(name, "lookup").(LookupInterface)
+}
+
+func LoadLookupPlugins() {
+  mod_names, _ := filepath.Glob(GetExecutableDir() + "/plugins/lookup/*.so")
+  for _, mod_name := range mod_names {
+    name := strings.TrimSuffix(filepath.Base(mod_name), ".so")
+    playbook.RegisterLookups(map[string]playbook.LookupFunc{name: LoadLookupPlugin(name).Run})
+  }
+}
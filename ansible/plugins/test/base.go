@@ -0,0 +1,14 @@
+package test
+
+import (
+  "../../playbook"
+)
+
+type TestPluginBase struct {
+}
+
+// plugins override this to return their tests, keyed by the
+// name they are used with in templates
+func (t *TestPluginBase) Tests() map[string]playbook.TestFunc {
+  return make(map[string]playbook.TestFunc)
+}
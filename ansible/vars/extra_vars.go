@@ -0,0 +1,52 @@
+package vars
+
+import (
+  "fmt"
+  "strings"
+  "github.com/smallfish/simpleyaml"
+  "../inventory"
+  "../playbook"
+)
+
+// LoadExtraVars merges the values given with -e on the command line, with
+// later values replacing earlier ones. Each value may be "@" and the name
+// of a YAML or JSON file, an inline YAML or JSON dictionary, or key=value
+// pairs as in "version=1.2 debug=true".
+func LoadExtraVars(values []string) (map[string]interface{}, error) {
+  extra_vars := make(map[string]interface{})
+  for _, value := range values {
+    value = strings.TrimSpace(value)
+    var data map[string]interface{}
+    var err error
+    switch {
+    case value == "":
+      continue
+    case strings.HasPrefix(value, "@"):
+      data, err = inventory.LoadVarsFile(value[1:])
+    case strings.HasPrefix(value, "{") || strings.HasPrefix(value, "["):
+      data, err = parseInlineVars(value)
+    default:
+      data = playbook.ParseKV(value, false)
+      if _, ok := data["_raw_params"]; ok {
+        err = fmt.Errorf("'%s' could not be made into a dictionary", value)
+      }
+    }
+    if err != nil {
+      return nil, fmt.Errorf("Invalid extra vars data supplied: %s", err)
+    }
+    combineVars(extra_vars, data)
+  }
+  return extra_vars, nil
+}
+
+func parseInlineVars(value string) (map[string]interface{}, error) {
+  yaml_data, err := simpleyaml.NewYaml([]byte(value))
+  if err != nil {
+    return nil, fmt.Errorf("'%s' is not valid YAML or JSON: %s", value, err)
+  }
+  data, err := yaml_data.Map()
+  if err != nil {
+    return nil, fmt.Errorf("'%s' could not be made into a dictionary", value)
+  }
+  return inventory.NormalizeValue(data).(map[string]interface{}), nil
+}
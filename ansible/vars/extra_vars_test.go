@@ -0,0 +1,105 @@
+package vars
+
+import (
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestLoadExtraVars(t *testing.T) {
+  dir := t.TempDir()
+  writeFile(t, filepath.Join(dir, "vars.yml"), "a: 1\nb: [x, z]\n")
+  writeFile(t, filepath.Join(dir, "vars.json"), `{"a": 2, "c": {"d": 1.5}}`)
+  writeFile(t, filepath.Join(dir, "list.yml"), "- a\n- b\n")
+
+  tests := []struct {
+    name string
+    values []string
+    want map[string]interface{}
+    err string
+  }{
+    {
+      name: "nothing given",
+      values: []string{},
+      want: map[string]interface{}{},
+    },
+    {
+      name: "key=value",
+      values: []string{"version=1.2 debug=true name='a b'"},
+      want: map[string]interface{}{"version": "1.2", "debug": "true", "name": "a b"},
+    },
+    {
+      name: "inline YAML",
+      values: []string{"{a: 1, b: [x, z], c: {d: e}}"},
+      want: map[string]interface{}{
+        "a": 1,
+        "b": []interface{}{"x", "z"},
+        "c": map[string]interface{}{"d": "e"},
+      },
+    },
+    {
+      name: "inline JSON",
+      values: []string{`{"a": 1, "b": true}`},
+      want: map[string]interface{}{"a": 1, "b": true},
+    },
+    {
+      name: "YAML file",
+      values: []string{"@" + filepath.Join(dir, "vars.yml")},
+      want: map[string]interface{}{"a": 1, "b": []interface{}{"x", "z"}},
+    },
+    {
+      name: "later values win",
+      values: []string{
+        "@" + filepath.Join(dir, "vars.yml"),
+        "@" + filepath.Join(dir, "vars.json"),
+        "c=3",
+      },
+      want: map[string]interface{}{"a": 2, "b": []interface{}{"x", "z"}, "c": "3"},
+    },
+    {
+      name: "empty values are skipped",
+      values: []string{"", "  ", "a=1"},
+      want: map[string]interface{}{"a": "1"},
+    },
+    {
+      name: "missing file",
+      values: []string{"@" + filepath.Join(dir, "nosuch.yml")},
+      err: "Invalid extra vars data supplied",
+    },
+    {
+      name: "file without a dictionary",
+      values: []string{"@" + filepath.Join(dir, "list.yml")},
+      err: "vars files must contain a dictionary of variables",
+    },
+    {
+      name: "inline list",
+      values: []string{"[1, 2]"},
+      err: "could not be made into a dictionary",
+    },
+    {
+      name: "invalid inline YAML",
+      values: []string{"{a: [1, 2}"},
+      err: "is not valid YAML or JSON",
+    },
+    {
+      name: "not key=value",
+      values: []string{"novalue"},
+      err: "'novalue' could not be made into a dictionary",
+    },
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      got, err := LoadExtraVars(test.values)
+      if test.err != "" {
+        if err == nil || !strings.Contains(err.Error(), test.err) {
+          t.Errorf("expected an error containing %q, got %v", test.err, err)
+        }
+      } else if err != nil {
+        t.Errorf("unexpected error: %s", err)
+      } else if !reflect.DeepEqual(got, test.want) {
+        t.Errorf("got %#v, want %#v", got, test.want)
+      }
+    })
+  }
+}
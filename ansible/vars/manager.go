@@ -0,0 +1,209 @@
+package vars
+
+import (
+  "fmt"
+  "path/filepath"
+  "strings"
+  "sync"
+  "../inventory"
+  "../playbook"
+)
+
+// VariableManager builds the variables for a host and task, merging each
+// source of variables in order of precedence (lowest first):
+//
+//   role defaults
+//   inventory group vars (see inventory.Host.GetGroupVars)
+//   inventory host vars (see inventory.Host.GetHostVars)
+//   facts gathered for the host
+//   play vars
+//   play vars_files
+//   role vars
+//   block vars
+//   task vars
+//   include_vars
+//   set_facts and registered vars
+//   extra vars (-e on the command line)
+//
+// with the magic variables (inventory_hostname, groups, etc.) added last.
+type VariableManager struct {
+  Inventory *inventory.InventoryManager
+  ExtraVars map[string]interface{}
+  // the directory of the playbook being run, which vars_files
+  // are loaded relative to
+  BaseDir string
+
+  // the per-host caches, keyed by host name
+  fact_cache map[string]map[string]interface{}
+  nonpersistent_fact_cache map[string]map[string]interface{}
+  vars_cache map[string]map[string]interface{}
+  // the contents of the vars_files, keyed by their full path
+  vars_files_cache map[string]map[string]interface{}
+  mutex sync.Mutex
+}
+
+// GetVars returns the variables for the given play, host and task,
+// any of which may be nil when they don't apply
+func (vm *VariableManager) GetVars(play *playbook.Play, host *inventory.Host, task *playbook.Task) (map[string]interface{}, error) {
+  vm.mutex.Lock()
+  defer vm.mutex.Unlock()
+
+  all_vars := make(map[string]interface{})
+
+  // FIXME: role defaults, once roles are loaded
+
+  if host != nil {
+    combineVars(all_vars, host.GetGroupVars())
+    combineVars(all_vars, host.GetHostVars())
+    if facts, ok := vm.fact_cache[host.Name]; ok {
+      combineVars(all_vars, facts)
+      all_vars["ansible_facts"] = namespaceFacts(facts)
+    }
+  }
+
+  if play != nil {
+    combineVars(all_vars, play.Vars())
+    // FIXME: vars_prompt
+    // the vars_files names may use the vars loaded so far, along with
+    // the extra vars and magic vars
+    temp_vars := make(map[string]interface{})
+    combineVars(temp_vars, all_vars)
+    combineVars(temp_vars, vm.ExtraVars)
+    combineVars(temp_vars, vm.getMagicVariables(play, host))
+    templar := playbook.NewTemplar(temp_vars)
+    for _, vars_file := range play.VarsFiles() {
+      res, err := templar.Template(vars_file)
+      if err != nil {
+        return nil, fmt.Errorf("Could not template vars_files %s: %s", vars_file, err)
+      }
+      file_vars, err := vm.loadVarsFile(fmt.Sprintf("%v", res))
+      if err != nil {
+        return nil, err
+      }
+      combineVars(all_vars, file_vars)
+    }
+    // FIXME: role vars, once roles are loaded
+  }
+
+  if task != nil {
+    // the task vars include those of the blocks it is in
+    combineVars(all_vars, task.GetVars())
+  }
+
+  if host != nil {
+    combineVars(all_vars, vm.vars_cache[host.Name])
+    combineVars(all_vars, vm.nonpersistent_fact_cache[host.Name])
+  }
+
+  combineVars(all_vars, vm.ExtraVars)
+  combineVars(all_vars, vm.getMagicVariables(play, host))
+  return all_vars, nil
+}
+
+func (vm *VariableManager) getMagicVariables(play *playbook.Play, host *inventory.Host) map[string]interface{} {
+  magic := make(map[string]interface{})
+  if vm.BaseDir != "" {
+    magic["playbook_dir"] = vm.BaseDir
+  }
+  if vm.Inventory != nil {
+    combineVars(magic, vm.Inventory.GetMagicVars())
+  }
+  if play != nil {
+    magic["ansible_play_name"] = play.Name()
+    if vm.Inventory != nil {
+      // the inventory is restricted to the current batch of hosts
+      play_hosts := make([]string, 0)
+      for _, h := range vm.Inventory.GetHosts(play.Hosts()) {
+        play_hosts = append(play_hosts, h.Name)
+      }
+      magic["ansible_play_batch"] = play_hosts
+      magic["play_hosts"] = play_hosts
+    }
+  }
+  if host != nil {
+    combineVars(magic, host.GetMagicVars())
+  }
+  return magic
+}
+
+// loads one of the play vars_files, relative to the playbook directory
+func (vm *VariableManager) loadVarsFile(path string) (map[string]interface{}, error) {
+  if !filepath.IsAbs(path) {
+    path = filepath.Join(vm.BaseDir, path)
+  }
+  if file_vars, ok := vm.vars_files_cache[path]; ok {
+    return file_vars, nil
+  }
+  file_vars, err := inventory.LoadVarsFile(path)
+  if err != nil {
+    return nil, fmt.Errorf("Could not load vars_files %s: %s", path, err)
+  }
+  vm.vars_files_cache[path] = file_vars
+  return file_vars, nil
+}
+
+// SetHostFacts merges gathered facts into the fact cache for the host
+func (vm *VariableManager) SetHostFacts(host string, facts map[string]interface{}) {
+  vm.mutex.Lock()
+  defer vm.mutex.Unlock()
+  setCacheVars(vm.fact_cache, host, facts)
+}
+
+// SetNonpersistentFacts sets facts which only last for this run, such as
+// those from set_fact or a registered result. These have a higher
+// precedence than the facts gathered for the host.
+func (vm *VariableManager) SetNonpersistentFacts(host string, facts map[string]interface{}) {
+  vm.mutex.Lock()
+  defer vm.mutex.Unlock()
+  setCacheVars(vm.nonpersistent_fact_cache, host, facts)
+}
+
+// SetHostVariable sets a variable for the host, as with include_vars
+func (vm *VariableManager) SetHostVariable(host string, key string, value interface{}) {
+  vm.mutex.Lock()
+  defer vm.mutex.Unlock()
+  setCacheVars(vm.vars_cache, host, map[string]interface{}{key: value})
+}
+
+// ClearFacts removes the gathered facts and set_facts for the host
+func (vm *VariableManager) ClearFacts(host string) {
+  vm.mutex.Lock()
+  defer vm.mutex.Unlock()
+  delete(vm.fact_cache, host)
+  delete(vm.nonpersistent_fact_cache, host)
+}
+
+func setCacheVars(cache map[string]map[string]interface{}, host string, vars map[string]interface{}) {
+  if _, ok := cache[host]; !ok {
+    cache[host] = make(map[string]interface{})
+  }
+  combineVars(cache[host], vars)
+}
+
+// later values replace earlier ones entirely, dictionaries are not merged
+func combineVars(dest map[string]interface{}, src map[string]interface{}) {
+  for k, v := range src {
+    dest[k] = v
+  }
+}
+
+// facts are also available under ansible_facts, without their prefix
+func namespaceFacts(facts map[string]interface{}) map[string]interface{} {
+  res := make(map[string]interface{})
+  for k, v := range facts {
+    res[strings.TrimPrefix(k, "ansible_")] = v
+  }
+  return res
+}
+
+func NewVariableManager(inventory *inventory.InventoryManager) *VariableManager {
+  vm := new(VariableManager)
+  vm.Inventory = inventory
+  vm.ExtraVars = make(map[string]interface{})
+  vm.BaseDir = ""
+  vm.fact_cache = make(map[string]map[string]interface{})
+  vm.nonpersistent_fact_cache = make(map[string]map[string]interface{})
+  vm.vars_cache = make(map[string]map[string]interface{})
+  vm.vars_files_cache = make(map[string]map[string]interface{})
+  return vm
+}
@@ -0,0 +1,200 @@
+package vars
+
+import (
+  "fmt"
+  "io/ioutil"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+  "github.com/smallfish/simpleyaml"
+  "../inventory"
+  "../playbook"
+)
+
+// the sources of variables, from the lowest precedence to the highest
+var precedence_levels = []string{
+  "group",
+  "host",
+  "fact",
+  "play",
+  "vars_file",
+  "block",
+  "task",
+  "include_vars",
+  "set_fact",
+  "extra",
+}
+
+// each level sets the variable for itself and every level above it, so
+// each variable should end up with the value from the level it is named
+// after if the levels are merged in order
+func levelVars(level int) map[string]interface{} {
+  vars := make(map[string]interface{})
+  for _, name := range precedence_levels[level:] {
+    vars["v_" + name] = precedence_levels[level]
+  }
+  return vars
+}
+
+func yamlVars(vars map[string]interface{}) string {
+  lines := make([]string, 0)
+  for k, v := range vars {
+    lines = append(lines, fmt.Sprintf("%s: %v", k, v))
+  }
+  return "{" + strings.Join(lines, ", ") + "}"
+}
+
+func writeFile(t *testing.T, path string, data string) {
+  if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+    t.Fatal(err)
+  }
+}
+
+// loads a play, the tasks in which may use the debug module
+func loadPlay(t *testing.T, data string) *playbook.Play {
+  playbook.ModuleCache["debug"] = playbook.ModuleInfo{Name: "debug.py", Path: "/nonexistent/debug.py"}
+  yaml_data, err := simpleyaml.NewYaml([]byte(data))
+  if err != nil {
+    t.Fatal(err)
+  }
+  play_data, err := yaml_data.Map()
+  if err != nil {
+    t.Fatal(err)
+  }
+  return playbook.NewPlay(play_data)
+}
+
+func TestGetVarsPrecedence(t *testing.T) {
+  dir := t.TempDir()
+
+  ini := "[web]\nweb1"
+  for k, v := range levelVars(1) {
+    ini += fmt.Sprintf(" %s=%v", k, v)
+  }
+  ini += "\n[web:vars]\n"
+  for k, v := range levelVars(0) {
+    ini += fmt.Sprintf("%s=%v\n", k, v)
+  }
+  writeFile(t, filepath.Join(dir, "hosts"), ini)
+  inv, err := inventory.NewInventoryManager([]string{filepath.Join(dir, "hosts")}, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // the vars_files name is templated with the play vars
+  writeFile(t, filepath.Join(dir, "vars.yml"), yamlVars(levelVars(4)))
+  play_vars := levelVars(3)
+  play_vars["vars_file_name"] = "vars.yml"
+  play := loadPlay(t, fmt.Sprintf(`
+hosts: all
+vars: %s
+vars_files: ["{{ vars_file_name }}"]
+tasks:
+  - block:
+      - debug: msg=hello
+        vars: %s
+    vars: %s
+`, yamlVars(play_vars), yamlVars(levelVars(6)), yamlVars(levelVars(5))))
+  tasks := play.Tasks[0].GetTasks()
+  if len(tasks) != 1 {
+    t.Fatalf("expected one task in the play, got %d", len(tasks))
+  }
+
+  vm := NewVariableManager(inv)
+  vm.BaseDir = dir
+  vm.SetHostFacts("web1", levelVars(2))
+  for k, v := range levelVars(7) {
+    vm.SetHostVariable("web1", k, v)
+  }
+  vm.SetNonpersistentFacts("web1", levelVars(8))
+  vm.ExtraVars = levelVars(9)
+
+  host := inv.GetHost("web1")
+  all_vars, err := vm.GetVars(play, host, &tasks[0])
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, level := range precedence_levels {
+    if got := all_vars["v_" + level]; got != level {
+      t.Errorf("v_%s: got %v, want %s", level, got, level)
+    }
+  }
+
+  // the magic variables always win
+  if got := all_vars["inventory_hostname"]; got != "web1" {
+    t.Errorf("inventory_hostname: got %v, want web1", got)
+  }
+  if got := all_vars["group_names"]; !reflect.DeepEqual(got, []string{"web"}) {
+    t.Errorf("group_names: got %v, want [web]", got)
+  }
+  if got := all_vars["playbook_dir"]; got != dir {
+    t.Errorf("playbook_dir: got %v, want %s", got, dir)
+  }
+}
+
+func TestGetVarsWithoutHostOrTask(t *testing.T) {
+  inv, err := inventory.NewInventoryManager([]string{}, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  vm := NewVariableManager(inv)
+  vm.ExtraVars = map[string]interface{}{"a": "extra"}
+  play := loadPlay(t, "hosts: all\nvars: {a: play, b: play}\n")
+
+  all_vars, err := vm.GetVars(play, nil, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if all_vars["a"] != "extra" || all_vars["b"] != "play" {
+    t.Errorf("got a=%v b=%v, want a=extra b=play", all_vars["a"], all_vars["b"])
+  }
+  if _, ok := all_vars["inventory_hostname"]; ok {
+    t.Errorf("inventory_hostname should not be set without a host")
+  }
+}
+
+func TestGetVarsFacts(t *testing.T) {
+  inv, err := inventory.NewInventoryManager([]string{}, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  inv.AddHost("web1", "")
+  vm := NewVariableManager(inv)
+  vm.SetHostFacts("web1", map[string]interface{}{"ansible_os_family": "Debian"})
+  host := inv.GetHost("web1")
+
+  all_vars, err := vm.GetVars(nil, host, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if all_vars["ansible_os_family"] != "Debian" {
+    t.Errorf("ansible_os_family: got %v, want Debian", all_vars["ansible_os_family"])
+  }
+  facts, _ := all_vars["ansible_facts"].(map[string]interface{})
+  if facts["os_family"] != "Debian" {
+    t.Errorf("ansible_facts.os_family: got %v, want Debian", facts["os_family"])
+  }
+
+  vm.ClearFacts("web1")
+  all_vars, err = vm.GetVars(nil, host, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, ok := all_vars["ansible_os_family"]; ok {
+    t.Errorf("ansible_os_family should be removed by ClearFacts")
+  }
+}
+
+func TestGetVarsMissingVarsFile(t *testing.T) {
+  inv, err := inventory.NewInventoryManager([]string{}, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  vm := NewVariableManager(inv)
+  vm.BaseDir = t.TempDir()
+  play := loadPlay(t, "hosts: all\nvars_files: [nosuch.yml]\n")
+  if _, err := vm.GetVars(play, nil, nil); err == nil || !strings.Contains(err.Error(), "Could not load vars_files") {
+    t.Errorf("expected a vars_files error, got %v", err)
+  }
+}